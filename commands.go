@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stackdump/on-chain-summer-2024/internal/config"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"github.com/stackdump/on-chain-summer-2024/internal/model"
+	"github.com/stackdump/on-chain-summer-2024/internal/service"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setupOffline is for commands that only read the chain: logs go to stderr so stdout
+// can be piped, and chains come from the config instead of the database.
+func setupOffline(cfg *config.Config) {
+	service.Logger = log.New(os.Stderr, "", log.Default().Flags())
+	service.UseConfigChains(cfg)
+}
+
+func syncCommand(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	from := fs.Int64("from", -1, "first block, defaults to the block after the highest indexed one")
+	to := fs.Int64("to", -1, "last block, defaults to the latest confirmed block")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	service.Logger = log.New(os.Stderr, "", log.Default().Flags())
+	if err := setupDatabase(cfg); err != nil {
+		return err
+	}
+	defer service.Psql.Close()
+
+	chainID := contract.ChainID
+	first, last, err := service.SyncRange(chainID, *from, *to)
+	if err != nil {
+		return err
+	}
+	log.Printf("sync chain %d blocks %d..%d", chainID, first, last)
+	indexed, err := service.Sync(chainID, first, last, func(block int64, indexed bool) {
+		if !indexed {
+			log.Printf("block %d already indexed", block)
+		} else if block%100 == 0 || block == last {
+			log.Printf("block %d indexed", block)
+		}
+	})
+	log.Printf("indexed %d blocks", indexed)
+	return err
+}
+
+func snapshotCommand(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	block := fs.String("block", "latest", "block number to read at")
+	format := fs.String("format", "json", "output format: json")
+	role := fs.String("role", "", "list only the actions of this role, by label or number")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	setupOffline(cfg)
+
+	number, err := service.ParseBlock(*block)
+	if err != nil {
+		return err
+	}
+	s, err := service.NewSnapshot(contract.Default(), number)
+	if err != nil {
+		return err
+	}
+	if *role != "" {
+		r, err := service.ParseRole(*role, s.Roles)
+		if err != nil {
+			return err
+		}
+		s = s.ForRole(r)
+	}
+	switch *format {
+	case "json":
+		_, err = os.Stdout.Write(s.ToJson())
+		return err
+	default:
+		return fmt.Errorf("unsupported format: %s", *format)
+	}
+}
+
+func svgCommand(args []string) error {
+	fs := flag.NewFlagSet("svg", flag.ExitOnError)
+	out := fs.String("out", "-", "output file, - for stdout")
+	block := fs.String("block", "latest", "block number to read at")
+	color := fs.String("color", "", "role to fill transitions with their role's color")
+	state := fs.String("state", "", "live to show the contract state and highlight enabled transitions")
+	layout := fs.String("layout", "", "positions: declared, auto, layered or force")
+	format := fs.String("format", "svg", "svg or png")
+	width := fs.Int("width", 0, "png width in pixels, 0 keeps the drawing's size")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	setupOffline(cfg)
+	if *format != "svg" && *format != "png" {
+		return fmt.Errorf("unsupported format: %s", *format)
+	}
+
+	number, err := service.ParseBlock(*block)
+	if err != nil {
+		return err
+	}
+	b, err := service.ResolveBlock(contract.Default(), number)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch {
+	case *color == "" && *state == "" && *format == "svg":
+		data, err = service.GetSvg(contract.Default(), b.CallOpts(), *layout)
+	case *color != "" && *color != "role":
+		err = fmt.Errorf("unsupported color: %s", *color)
+	case *state != "" && *state != "live":
+		err = fmt.Errorf("unsupported state: %s", *state)
+	default:
+		req := service.SvgRequest{RoleColors: *color == "role", Layout: *layout}
+		if *state == "live" {
+			req.Snapshot, err = service.NewSnapshot(contract.Default(), new(big.Int).SetUint64(b.Number))
+			if err != nil {
+				return err
+			}
+		}
+		if *format == "png" {
+			data, err = service.RenderPng(contract.Default(), b.CallOpts(), req, *width)
+		} else {
+			data, err = service.RenderSvg(contract.Default(), b.CallOpts(), req)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, data)
+}
+
+func replayCommand(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	block := fs.String("block", "latest", "replay up to and including this block")
+	from := fs.Int64("from", -1, "first block to read events from, defaults to the contract's deployment block")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	setupOffline(cfg)
+
+	number, err := service.ParseBlock(*block)
+	if err != nil {
+		return err
+	}
+	b, err := service.ResolveBlock(contract.Default(), number)
+	if err != nil {
+		return err
+	}
+	start := *from
+	if start < 0 {
+		start = int64(cfg.DefaultContract().DeploymentBlock)
+	}
+	h, err := service.Replay(contract.Default(), uint64(start), b)
+	if err != nil {
+		return err
+	}
+	if err := printJson(h); err != nil {
+		return err
+	}
+	if h.Diverged {
+		return errors.New("replayed state differs from the contract state")
+	}
+	return nil
+}
+
+func animateCommand(args []string) error {
+	fs := flag.NewFlagSet("animate", flag.ExitOnError)
+	out := fs.String("out", "", "output file, .svg or .gif")
+	block := fs.String("block", "latest", "replay up to and including this block")
+	from := fs.Int64("from", -1, "first block to read events from, defaults to the contract's deployment block")
+	player := fs.String("player", "", "only show the signals sent by this address")
+	delay := fs.Duration("delay", model.FrameDelay, "how long each frame is shown")
+	color := fs.String("color", "", "role to fill transitions with their role's color")
+	layout := fs.String("layout", "", "positions: declared, auto, layered or force")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	setupOffline(cfg)
+
+	var encode func(contract.DeclarationPetriNet, []model.Frame, model.SvgOptions, time.Duration) ([]byte, error)
+	switch filepath.Ext(*out) {
+	case ".svg":
+		encode = model.EncodeAnimatedSvg
+	case ".gif":
+		encode = model.EncodeGif
+	default:
+		return fmt.Errorf("-out must name an .svg or .gif file")
+	}
+	if *color != "" && *color != "role" {
+		return fmt.Errorf("unsupported color: %s", *color)
+	}
+	var address *common.Address
+	if *player != "" {
+		if !common.IsHexAddress(*player) {
+			return fmt.Errorf("invalid player address: %s", *player)
+		}
+		a := common.HexToAddress(*player)
+		address = &a
+	}
+
+	number, err := service.ParseBlock(*block)
+	if err != nil {
+		return err
+	}
+	d := contract.Default()
+	b, err := service.ResolveBlock(d, number)
+	if err != nil {
+		return err
+	}
+	start := *from
+	if start < 0 {
+		start = int64(cfg.DefaultContract().DeploymentBlock)
+	}
+	h, err := service.Replay(d, uint64(start), b)
+	if err != nil {
+		return err
+	}
+	frames, err := service.ReplayFrames(d, h, address)
+	if err != nil {
+		return err
+	}
+	decl, err := service.GetLayout(d, b.CallOpts(), *layout)
+	if err != nil {
+		return err
+	}
+	opts, err := service.SvgOptions(d, b.CallOpts(), service.SvgRequest{RoleColors: *color == "role"})
+	if err != nil {
+		return err
+	}
+	data, err := encode(decl, frames, opts, *delay)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, data)
+}
+
+type simulatedStep struct {
+	Action string  `json:"action"`
+	Scalar int64   `json:"scalar"`
+	State  []int64 `json:"state"`
+	Error  string  `json:"error,omitempty"`
+}
+
+func simulateCommand(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	actions := fs.String("actions", "-", "file with one action label per line, optionally followed by a scalar")
+	live := fs.Bool("live", false, "start from the contract state instead of the initial marking")
+	block := fs.String("block", "latest", "block to read the model and live state at")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	setupOffline(cfg)
+
+	number, err := service.ParseBlock(*block)
+	if err != nil {
+		return err
+	}
+	b, err := service.ResolveBlock(contract.Default(), number)
+	if err != nil {
+		return err
+	}
+	d := contract.Default()
+	net, err := service.GetModel(d, b.CallOpts())
+	if err != nil {
+		return err
+	}
+	state := service.InitialState(net)
+	if *live {
+		state, err = service.GetContractState(d, net, b.CallOpts())
+		if err != nil {
+			return err
+		}
+	}
+
+	input, err := readInput(*actions)
+	if err != nil {
+		return err
+	}
+	steps := []simulatedStep{}
+	var failed error
+	scanner := bufio.NewScanner(strings.NewReader(string(input)))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		step := simulatedStep{Action: fields[0], Scalar: 1}
+		if len(fields) > 1 {
+			step.Scalar, err = strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s:%d: invalid scalar %q", *actions, line, fields[1])
+			}
+		}
+		offset, ok := service.ActionOffset(net, step.Action)
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown action %q", *actions, line, step.Action)
+		}
+		state, failed = service.Fire(net, state, offset, step.Scalar)
+		step.State = state
+		if failed != nil {
+			step.Error = failed.Error()
+		}
+		steps = append(steps, step)
+		if failed != nil {
+			break
+		}
+	}
+	if err := printJson(map[string]any{"steps": steps, "state": state}); err != nil {
+		return err
+	}
+	return failed
+}
+
+func convertCommand(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	in := fs.String("in", "-", "model file to read, json, pnml or recipe, - for stdin")
+	out := fs.String("out", "-", "output file, - for stdout")
+	format := fs.String("format", "json", "output format: json, pnml, dot, mermaid, sol")
+	name := fs.String("name", "", "net name for pnml and dot, defaults to the input file name")
+	contractName := fs.String("contract", "", "state machine contract name for sol, defaults to MyStateMachine")
+	roles := fs.String("roles", "", "comma separated role names for sol, in role order")
+	check := fs.Bool("check", false, "fail unless the output is identical to the input, for golden files")
+	layout := fs.String("layout", "", "replace positions: declared, auto, layered or force")
+	_ = fs.Parse(args)
+
+	input, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+	decl, err := decodeModel(input)
+	if err != nil {
+		return err
+	}
+	if _, err := model.Compile(decl); err != nil {
+		return err
+	}
+	decl, err = model.Layout(decl, *layout)
+	if err != nil {
+		return err
+	}
+
+	if *name == "" {
+		*name = strings.TrimSuffix(filepath.Base(*in), filepath.Ext(*in))
+	}
+	var output []byte
+	switch *format {
+	case "json":
+		output, err = model.EncodeJson(decl)
+	case "pnml":
+		output, err = model.EncodePnml(decl, *name)
+	case "dot":
+		output = model.EncodeDot(decl, *name, nil)
+	case "mermaid":
+		output = model.EncodeMermaid(decl, nil)
+	case "sol":
+		opts := model.SolidityOptions{Contract: *contractName}
+		if *roles != "" {
+			opts.Roles = strings.Split(*roles, ",")
+		}
+		output, err = model.EncodeSolidity(decl, opts)
+	default:
+		err = fmt.Errorf("unsupported format: %s", *format)
+	}
+	if err != nil {
+		return err
+	}
+	if *check {
+		if !bytes.Equal(input, output) {
+			return fmt.Errorf("%s does not round-trip as %s", *in, *format)
+		}
+		return nil
+	}
+	return writeOutput(*out, output)
+}
+
+func codegenCommand(args []string) error {
+	fs := flag.NewFlagSet("codegen", flag.ExitOnError)
+	lang := fs.String("lang", "go", "output language: go, ts")
+	out := fs.String("out", "-", "output file, - for stdout")
+	pkg := fs.String("package", "", "Go package name, defaults to the output directory name")
+	roles := fs.String("roles", "", "comma separated role names, in role order")
+	block := fs.String("block", "latest", "block to read the model at")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	setupOffline(cfg)
+
+	number, err := service.ParseBlock(*block)
+	if err != nil {
+		return err
+	}
+	b, err := service.ResolveBlock(contract.Default(), number)
+	if err != nil {
+		return err
+	}
+	d := contract.Default()
+	net, err := service.GetModel(d, b.CallOpts())
+	if err != nil {
+		return err
+	}
+	var names []string
+	if *roles != "" {
+		names = strings.Split(*roles, ",")
+	}
+	source := d.String()
+	if cfg.Model != "" {
+		source = filepath.Base(cfg.Model)
+	}
+
+	var output []byte
+	switch *lang {
+	case "go":
+		if *pkg == "" {
+			*pkg = "model"
+			if *out != "-" {
+				*pkg = filepath.Base(filepath.Dir(*out))
+			}
+		}
+		output, err = model.EncodeGo(net, *pkg, names, source)
+	case "ts":
+		output, err = model.EncodeTypeScript(net, names, source)
+	default:
+		err = fmt.Errorf("unsupported language: %s", *lang)
+	}
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, output)
+}
+
+func modeldiffCommand(args []string) error {
+	fs := flag.NewFlagSet("modeldiff", flag.ExitOnError)
+	against := fs.String("against", "", "model file or contract address on the default chain to upgrade to")
+	block := fs.String("block", "latest", "block to read the current model at")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	setupOffline(cfg)
+	if *against == "" {
+		return errors.New("-against is required")
+	}
+
+	number, err := service.ParseBlock(*block)
+	if err != nil {
+		return err
+	}
+	b, err := service.ResolveBlock(contract.Default(), number)
+	if err != nil {
+		return err
+	}
+	before, err := service.GetDeclaration(contract.Default(), b.CallOpts())
+	if err != nil {
+		return err
+	}
+	var decl contract.DeclarationPetriNet
+	if common.IsHexAddress(*against) {
+		decl, err = service.GetDeclaration(contract.Deployment{ChainID: contract.ChainID, Address: common.HexToAddress(*against)}, nil)
+	} else {
+		var input []byte
+		input, err = readInput(*against)
+		if err == nil {
+			decl, err = decodeModel(input)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	diff, err := model.CompareModels(before, decl)
+	if err != nil {
+		return err
+	}
+	if err := printJson(diff); err != nil {
+		return err
+	}
+	if !diff.Compatible {
+		return errors.New("indexed history cannot be replayed under the new model")
+	}
+	return nil
+}
+
+// decodeModel reads PNML, pflow v0 JSON or a recipe file, whichever the data looks like.
+func decodeModel(data []byte) (contract.DeclarationPetriNet, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return model.DecodePnml(data)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return model.DecodeJson(data)
+	default:
+		return model.DecodeRecipe(data)
+	}
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func printJson(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config is the effective service configuration: built-in defaults, then a YAML file,
+// then environment variables, then command-line flags.
+type Config struct {
+	Listen       string     `yaml:"listen" json:"listen"`
+	AdminToken   string     `yaml:"admin_token" json:"admin_token"`
+	Database     Database   `yaml:"database" json:"database"`
+	DefaultChain int64      `yaml:"default_chain_id" json:"default_chain_id"`
+	Default      string     `yaml:"default_contract" json:"default_contract"`
+	Model        string     `yaml:"model" json:"model,omitempty"`
+	Chains       []Chain    `yaml:"chains" json:"chains"`
+	Contracts    []Contract `yaml:"contracts" json:"contracts"`
+	Telemetry    Telemetry  `yaml:"telemetry" json:"telemetry"`
+}
+
+// Database holds either a full DSN or the parts to build one.
+type Database struct {
+	DSN         string `yaml:"dsn" json:"dsn,omitempty"`
+	Host        string `yaml:"host" json:"host"`
+	Port        int    `yaml:"port" json:"port,omitempty"`
+	User        string `yaml:"user" json:"user"`
+	Password    string `yaml:"password" json:"password"`
+	Name        string `yaml:"name" json:"name"`
+	SSLMode     string `yaml:"sslmode" json:"sslmode"`
+	SSLRootCert string `yaml:"sslrootcert" json:"sslrootcert,omitempty"`
+}
+
+type Chain struct {
+	ID            int64    `yaml:"chain_id" json:"chain_id"`
+	Name          string   `yaml:"name" json:"name"`
+	Endpoints     []string `yaml:"endpoints" json:"endpoints"`
+	Confirmations int      `yaml:"confirmations" json:"confirmations"`
+	PollInterval  Duration `yaml:"poll_interval" json:"poll_interval"`
+}
+
+type Contract struct {
+	ChainID         int64    `yaml:"chain_id" json:"chain_id"`
+	Address         string   `yaml:"address" json:"address"`
+	Label           string   `yaml:"label" json:"label"`
+	DeploymentBlock int      `yaml:"deployment_block" json:"deployment_block"`
+	Roles           []string `yaml:"roles" json:"roles,omitempty"` // role labels by role number
+}
+
+type Telemetry struct {
+	AppName  string   `yaml:"app_name" json:"app_name"`
+	NewRelic NewRelic `yaml:"new_relic" json:"new_relic"`
+}
+
+type NewRelic struct {
+	License       string `yaml:"license_key" json:"license_key"`
+	LogForwarding bool   `yaml:"log_forwarding" json:"log_forwarding"`
+}
+
+// Duration reads Go duration strings such as "30s" from YAML and writes them back as strings.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func Defaults() *Config {
+	return &Config{
+		Listen: ":8080",
+		Database: Database{
+			Name:    "postgres",
+			SSLMode: "require",
+		},
+		Telemetry: Telemetry{
+			AppName: "onchain-summer-2024",
+			NewRelic: NewRelic{
+				LogForwarding: true,
+			},
+		},
+	}
+}
+
+// ConnString is the lib/pq connection string, a configured DSN wins over the individual fields.
+func (d Database) ConnString() string {
+	if d.DSN != "" {
+		return d.DSN
+	}
+	var parts []string
+	add := func(key, value string) {
+		if value != "" {
+			parts = append(parts, key+"="+quoteConnValue(value))
+		}
+	}
+	add("host", d.Host)
+	if d.Port != 0 {
+		add("port", fmt.Sprint(d.Port))
+	}
+	add("user", d.User)
+	add("password", d.Password)
+	add("dbname", d.Name)
+	add("sslmode", d.SSLMode)
+	add("sslrootcert", d.SSLRootCert)
+	return strings.Join(parts, " ")
+}
+
+func quoteConnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// Chain returns the configured chain by ID.
+func (c *Config) Chain(id int64) (*Chain, bool) {
+	for i := range c.Chains {
+		if c.Chains[i].ID == id {
+			return &c.Chains[i], true
+		}
+	}
+	return nil, false
+}
+
+// DefaultContract is the contract served by the unprefixed /v0 routes.
+func (c *Config) DefaultContract() Contract {
+	for _, ct := range c.Contracts {
+		if (c.Default == "" || strings.EqualFold(ct.Address, c.Default)) && (c.DefaultChain == 0 || ct.ChainID == c.DefaultChain) {
+			return ct
+		}
+	}
+	return Contract{ChainID: c.DefaultChain, Address: c.Default}
+}
+
+// Validate reports every problem at once so a bad deploy fails with a complete list.
+// The database is checked separately, commands that only read the chain do not need it.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Listen == "" {
+		errs = append(errs, errors.New("listen address is required"))
+	}
+	seen := map[int64]bool{}
+	for _, ch := range c.Chains {
+		if ch.ID <= 0 {
+			errs = append(errs, fmt.Errorf("chain %q: chain_id must be positive", ch.Name))
+		}
+		if seen[ch.ID] {
+			errs = append(errs, fmt.Errorf("chain %d: declared twice", ch.ID))
+		}
+		seen[ch.ID] = true
+		if ch.Name == "" {
+			errs = append(errs, fmt.Errorf("chain %d: name is required", ch.ID))
+		}
+		if len(ch.Endpoints) == 0 {
+			errs = append(errs, fmt.Errorf("chain %d: at least one endpoint is required", ch.ID))
+		}
+		for _, e := range ch.Endpoints {
+			if u, err := url.Parse(e); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("chain %d: invalid endpoint %q", ch.ID, redactUrl(e)))
+			}
+		}
+		if ch.Confirmations < 0 {
+			errs = append(errs, fmt.Errorf("chain %d: confirmations must not be negative", ch.ID))
+		}
+		if time.Duration(ch.PollInterval) < time.Second {
+			errs = append(errs, fmt.Errorf("chain %d: poll_interval must be at least 1s", ch.ID))
+		}
+	}
+
+	for _, ct := range c.Contracts {
+		if !common.IsHexAddress(ct.Address) {
+			errs = append(errs, fmt.Errorf("contract %q: invalid address %q", ct.Label, ct.Address))
+		}
+		if !seen[ct.ChainID] {
+			errs = append(errs, fmt.Errorf("contract %s: chain %d is not configured", ct.Address, ct.ChainID))
+		}
+	}
+
+	// a model file stands in for the default contract
+	if c.Model != "" {
+		return errors.Join(errs...)
+	}
+	d := c.DefaultContract()
+	if !common.IsHexAddress(d.Address) {
+		errs = append(errs, errors.New("a default contract is required (default_contract, CONTRACT_ADDRESS or contracts)"))
+	}
+	if !seen[d.ChainID] {
+		errs = append(errs, fmt.Errorf("default chain %d is not configured", d.ChainID))
+	}
+	return errors.Join(errs...)
+}
+
+func (d Database) Validate() error {
+	if d.DSN != "" {
+		return nil
+	}
+	var errs []error
+	if d.User == "" {
+		errs = append(errs, errors.New("database.user (DB_USERNAME) is required"))
+	}
+	if d.Password == "" {
+		errs = append(errs, errors.New("database.password (DB_PASSWORD) is required"))
+	}
+	switch d.SSLMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("database.sslmode %q is not one of disable, require, verify-ca, verify-full", d.SSLMode))
+	}
+	return errors.Join(errs...)
+}
+
+const redacted = "REDACTED"
+
+// Redacted is a copy safe to expose: passwords, tokens, license keys and endpoint paths are masked.
+func (c *Config) Redacted() *Config {
+	out := *c
+	if out.AdminToken != "" {
+		out.AdminToken = redacted
+	}
+	if out.Database.Password != "" {
+		out.Database.Password = redacted
+	}
+	if out.Database.DSN != "" {
+		out.Database.DSN = redactDsn(out.Database.DSN)
+	}
+	if out.Telemetry.NewRelic.License != "" {
+		out.Telemetry.NewRelic.License = redacted
+	}
+	out.Chains = make([]Chain, len(c.Chains))
+	for i, ch := range c.Chains {
+		ch.Endpoints = make([]string, len(c.Chains[i].Endpoints))
+		for j, e := range c.Chains[i].Endpoints {
+			ch.Endpoints[j] = redactUrl(e)
+		}
+		out.Chains[i] = ch
+	}
+	out.Contracts = append([]Contract(nil), c.Contracts...)
+	return &out
+}
+
+// redactUrl keeps the scheme and host, hosted RPC providers put API keys in the path or query.
+func redactUrl(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	out := u.Scheme + "://" + u.Host
+	if u.Path != "" && u.Path != "/" || u.RawQuery != "" {
+		out += "/" + redacted
+	}
+	return out
+}
+
+// redactDsn masks password and sslpassword in both the URL and the keyword/value forms, quoted values may contain spaces.
+func redactDsn(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		q := u.Query()
+		for _, key := range []string{"password", "sslpassword"} {
+			if q.Has(key) {
+				q.Set(key, redacted)
+				u.RawQuery = q.Encode()
+			}
+		}
+		return u.String()
+	}
+	var out strings.Builder
+	for rest := dsn; ; {
+		i := strings.Index(rest, "password=")
+		if i < 0 {
+			out.WriteString(rest)
+			return out.String()
+		}
+		start := i + len("password=")
+		out.WriteString(rest[:start])
+		if key := strings.TrimSuffix(rest[:i], "ssl"); key == "" || strings.ContainsAny(key[len(key)-1:], " \t\n") {
+			out.WriteString(redacted)
+			rest = rest[start+connValueLen(rest[start:]):]
+		} else {
+			rest = rest[start:]
+		}
+	}
+}
+
+// connValueLen is the length of the keyword/value connection string value at the start of s.
+func connValueLen(s string) int {
+	if !strings.HasPrefix(s, "'") {
+		if i := strings.IndexAny(s, " \t\n"); i >= 0 {
+			return i
+		}
+		return len(s)
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\'':
+			return i + 1
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+const testAddress = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+
+func testChain() Chain {
+	return Chain{ID: 31337, Name: "hardhat", Endpoints: []string{"http://localhost:8545"}, PollInterval: Duration(time.Minute)}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config Config
+		err    string
+	}{
+		{
+			name:   "valid",
+			config: Config{Listen: ":8080", Default: testAddress, Chains: []Chain{testChain()}, Contracts: []Contract{{ChainID: 31337, Address: testAddress}}},
+		},
+		{
+			name:   "model file",
+			config: Config{Listen: ":8080", Model: "jetsam.json"},
+		},
+		{
+			name:   "no default contract",
+			config: Config{Listen: ":8080"},
+			err:    "a default contract is required (default_contract, CONTRACT_ADDRESS or contracts)\ndefault chain 0 is not configured",
+		},
+		{
+			name: "chain",
+			config: Config{Model: "jetsam.json", Chains: []Chain{
+				testChain(),
+				{ID: 31337, Endpoints: []string{"localhost:8545", "https://eth.example.com/v2/secret"}, Confirmations: -1},
+			}},
+			err: "listen address is required\n" +
+				"chain 31337: declared twice\n" +
+				"chain 31337: name is required\n" +
+				`chain 31337: invalid endpoint "REDACTED"` + "\n" +
+				"chain 31337: confirmations must not be negative\n" +
+				"chain 31337: poll_interval must be at least 1s",
+		},
+		{
+			name:   "chain id",
+			config: Config{Listen: ":8080", Model: "jetsam.json", Chains: []Chain{{Name: "none", PollInterval: Duration(time.Second)}}},
+			err:    "chain \"none\": chain_id must be positive\nchain 0: at least one endpoint is required",
+		},
+		{
+			name:   "contract",
+			config: Config{Listen: ":8080", Model: "jetsam.json", Contracts: []Contract{{ChainID: 1, Address: "0x12", Label: "short"}}},
+			err:    "contract \"short\": invalid address \"0x12\"\ncontract 0x12: chain 1 is not configured",
+		},
+		{
+			name:   "default chain",
+			config: Config{Listen: ":8080", Default: testAddress, DefaultChain: 1, Chains: []Chain{testChain()}},
+			err:    "default chain 1 is not configured",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.err == "" && err != nil || tc.err != "" && (err == nil || err.Error() != tc.err) {
+				t.Errorf("err = %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestDatabaseValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		database Database
+		err      string
+	}{
+		{name: "dsn", database: Database{DSN: "postgres://localhost/postgres"}},
+		{name: "parts", database: Database{User: "indexer", Password: "secret", SSLMode: "disable"}},
+		{
+			name:     "missing",
+			database: Database{SSLMode: "prefer"},
+			err: "database.user (DB_USERNAME) is required\n" +
+				"database.password (DB_PASSWORD) is required\n" +
+				`database.sslmode "prefer" is not one of disable, require, verify-ca, verify-full`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.database.Validate()
+			if tc.err == "" && err != nil || tc.err != "" && (err == nil || err.Error() != tc.err) {
+				t.Errorf("err = %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestConnString(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		database Database
+		want     string
+	}{
+		{name: "dsn wins", database: Database{DSN: "postgres://localhost/db", User: "ignored"}, want: "postgres://localhost/db"},
+		{name: "defaults", database: Defaults().Database, want: "dbname=postgres sslmode=require"},
+		{
+			name:     "parts",
+			database: Database{Host: "db", Port: 5432, User: "indexer", Password: "secret", Name: "chain", SSLMode: "verify-full", SSLRootCert: "/etc/ca.pem"},
+			want:     "host=db port=5432 user=indexer password=secret dbname=chain sslmode=verify-full sslrootcert=/etc/ca.pem",
+		},
+		{name: "quoted", database: Database{User: "indexer", Password: `it's a \ secret`}, want: `user=indexer password='it\'s a \\ secret'`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.database.ConnString(); got != tc.want {
+				t.Errorf("ConnString() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestQuoteConnValue(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  string
+	}{
+		{value: "plain", want: "plain"},
+		{value: "", want: "''"},
+		{value: "two words", want: "'two words'"},
+		{value: "it's", want: `'it\'s'`},
+		{value: `back\slash`, want: `'back\\slash'`},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			if got := quoteConnValue(tc.value); got != tc.want {
+				t.Errorf("quoteConnValue(%q) = %q, want %q", tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRedactUrl(t *testing.T) {
+	for _, tc := range []struct {
+		url  string
+		want string
+	}{
+		{url: "http://localhost:8545", want: "http://localhost:8545"},
+		{url: "https://eth.example.com/", want: "https://eth.example.com"},
+		{url: "https://eth.example.com/v2/secret", want: "https://eth.example.com/REDACTED"},
+		{url: "https://eth.example.com?key=secret", want: "https://eth.example.com/REDACTED"},
+		{url: "localhost:8545", want: "REDACTED"},
+		{url: "://secret", want: "REDACTED"},
+	} {
+		t.Run(tc.url, func(t *testing.T) {
+			if got := redactUrl(tc.url); got != tc.want {
+				t.Errorf("redactUrl(%q) = %q, want %q", tc.url, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRedactDsn(t *testing.T) {
+	for _, tc := range []struct {
+		dsn  string
+		want string
+	}{
+		{dsn: "postgres://indexer:secret@db:5432/chain?sslmode=require", want: "postgres://indexer:REDACTED@db:5432/chain?sslmode=require"},
+		{dsn: "postgres://indexer@db/chain", want: "postgres://indexer@db/chain"},
+		{dsn: "postgres://db/chain?user=indexer&password=secret", want: "postgres://db/chain?password=REDACTED&user=indexer"},
+		{dsn: "host=db user=indexer password=secret dbname=chain", want: "host=db user=indexer password=REDACTED dbname=chain"},
+		{dsn: "password=secret", want: "password=REDACTED"},
+		{dsn: `user=indexer password='it\'s a secret' dbname=chain`, want: "user=indexer password=REDACTED dbname=chain"},
+		{dsn: "user=indexer sslpassword=key password='two words'", want: "user=indexer sslpassword=REDACTED password=REDACTED"},
+		{dsn: "host=db dbname=chain", want: "host=db dbname=chain"},
+	} {
+		t.Run(tc.dsn, func(t *testing.T) {
+			if got := redactDsn(tc.dsn); got != tc.want {
+				t.Errorf("redactDsn(%q) = %q, want %q", tc.dsn, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := &Config{
+		AdminToken: "token",
+		Database:   Database{DSN: "postgres://indexer:secret@db/chain", Password: "secret"},
+		Chains:     []Chain{{ID: 1, Endpoints: []string{"https://eth.example.com/v2/secret"}}},
+		Contracts:  []Contract{{ChainID: 1, Address: testAddress}},
+		Telemetry:  Telemetry{NewRelic: NewRelic{License: "license"}},
+	}
+	r := c.Redacted()
+	for _, tc := range []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "admin token", got: r.AdminToken, want: "REDACTED"},
+		{name: "password", got: r.Database.Password, want: "REDACTED"},
+		{name: "dsn", got: r.Database.DSN, want: "postgres://indexer:REDACTED@db/chain"},
+		{name: "license", got: r.Telemetry.NewRelic.License, want: "REDACTED"},
+		{name: "endpoint", got: r.Chains[0].Endpoints[0], want: "https://eth.example.com/REDACTED"},
+		{name: "original endpoint", got: c.Chains[0].Endpoints[0], want: "https://eth.example.com/v2/secret"},
+		{name: "original token", got: c.AdminToken, want: "token"},
+		{name: "contract", got: r.Contracts[0].Address, want: testAddress},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.got != tc.want {
+				t.Errorf("%s = %q, want %q", tc.name, tc.got, tc.want)
+			}
+		})
+	}
+	if empty := (&Config{}).Redacted(); empty.AdminToken != "" || empty.Database.Password != "" || empty.Telemetry.NewRelic.License != "" {
+		t.Errorf("unset secrets were filled in: %+v", empty)
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Flags are the command-line overrides shared by every subcommand.
+type Flags struct {
+	fs       *flag.FlagSet
+	path     string
+	listen   string
+	dsn      string
+	chainID  int64
+	address  string
+	endpoint string
+	model    string
+}
+
+// Bind registers the config flags on fs, call Load after fs.Parse.
+func Bind(fs *flag.FlagSet) *Flags {
+	f := &Flags{fs: fs}
+	fs.StringVar(&f.path, "config", os.Getenv("CONFIG_FILE"), "path to a YAML config file (CONFIG_FILE)")
+	fs.StringVar(&f.listen, "listen", "", "HTTP listen address (LISTEN_ADDR)")
+	fs.StringVar(&f.dsn, "db-dsn", "", "Postgres connection string (DB_DSN)")
+	fs.Int64Var(&f.chainID, "chain-id", 0, "default chain ID (CHAIN_ID)")
+	fs.StringVar(&f.address, "address", "", "default contract address (CONTRACT_ADDRESS)")
+	fs.StringVar(&f.endpoint, "endpoint", "", "RPC endpoint tried first for the default chain (ENDPOINT)")
+	fs.StringVar(&f.model, "model", "", "serve a pflow model or snapshot JSON file instead of the chain (MODEL_FILE)")
+	return f
+}
+
+// Load layers the config file, environment and flags over the defaults and validates the result.
+func (f *Flags) Load() (*Config, error) {
+	c := Defaults()
+	if f.path != "" {
+		if err := loadFile(c, f.path); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(c); err != nil {
+		return nil, err
+	}
+	f.apply(c)
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return c, nil
+}
+
+func loadFile(c *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func applyEnv(c *Config) error {
+	str := func(name string, target *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*target = v
+		}
+	}
+	str("LISTEN_ADDR", &c.Listen)
+	str("ADMIN_TOKEN", &c.AdminToken)
+	str("DB_DSN", &c.Database.DSN)
+	str("DB_HOSTNAME", &c.Database.Host)
+	str("DB_USERNAME", &c.Database.User)
+	str("DB_PASSWORD", &c.Database.Password)
+	str("DB_NAME", &c.Database.Name)
+	str("DB_SSLMODE", &c.Database.SSLMode)
+	str("DB_SSLROOTCERT", &c.Database.SSLRootCert)
+	str("CONTRACT_ADDRESS", &c.Default)
+	str("MODEL_FILE", &c.Model)
+	str("APP_NAME", &c.Telemetry.AppName)
+	str("NEW_RELIC_LICENSE_KEY", &c.Telemetry.NewRelic.License)
+
+	if v, ok := os.LookupEnv("DB_PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("DB_PORT: %w", err)
+		}
+		c.Database.Port = port
+	}
+	if v, ok := os.LookupEnv("CHAIN_ID"); ok {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("CHAIN_ID: %w", err)
+		}
+		c.DefaultChain = id
+	}
+	if v, ok := os.LookupEnv("POLL_INTERVAL"); ok {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("POLL_INTERVAL: %w", err)
+		}
+		for i := range c.Chains {
+			c.Chains[i].PollInterval = Duration(interval)
+		}
+	}
+	if v, ok := os.LookupEnv("ENDPOINT"); ok && v != "" {
+		c.prependEndpoint(v)
+	}
+	return nil
+}
+
+// apply only overrides values for flags that were set on the command line.
+func (f *Flags) apply(c *Config) {
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "listen":
+			c.Listen = f.listen
+		case "db-dsn":
+			c.Database.DSN = f.dsn
+		case "chain-id":
+			c.DefaultChain = f.chainID
+		case "address":
+			c.Default = f.address
+		case "endpoint":
+			c.prependEndpoint(f.endpoint)
+		case "model":
+			c.Model = f.model
+		}
+	})
+}
+
+// prependEndpoint puts endpoint first for the default chain, declaring the chain if the file did not.
+func (c *Config) prependEndpoint(endpoint string) {
+	id := c.DefaultChain
+	if id == 0 {
+		id = c.DefaultContract().ChainID
+	}
+	if ch, ok := c.Chain(id); ok {
+		ch.Endpoints = append([]string{endpoint}, ch.Endpoints...)
+		return
+	}
+	c.Chains = append(c.Chains, Chain{
+		ID:           id,
+		Name:         strconv.FormatInt(id, 10),
+		Endpoints:    []string{endpoint},
+		PollInterval: Duration(time.Minute),
+	})
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable Load reads, t.Setenv restores them after the test.
+func clearEnv(t *testing.T) {
+	for _, name := range []string{
+		"CONFIG_FILE", "LISTEN_ADDR", "ADMIN_TOKEN", "DB_DSN", "DB_HOSTNAME", "DB_USERNAME", "DB_PASSWORD", "DB_NAME",
+		"DB_SSLMODE", "DB_SSLROOTCERT", "DB_PORT", "CONTRACT_ADDRESS", "MODEL_FILE", "APP_NAME", "NEW_RELIC_LICENSE_KEY",
+		"CHAIN_ID", "POLL_INTERVAL", "ENDPOINT",
+	} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+const testConfigFile = `
+listen: ":9090"
+default_chain_id: 31337
+default_contract: "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+database:
+  host: db
+  user: indexer
+chains:
+  - chain_id: 31337
+    name: hardhat
+    endpoints: ["http://localhost:8545"]
+    poll_interval: 30s
+  - chain_id: 8453
+    name: base
+    endpoints: ["https://mainnet.base.org"]
+    poll_interval: 1m
+contracts:
+  - chain_id: 31337
+    address: "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+    label: jetsam
+`
+
+func TestLoad(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		file  string
+		env   map[string]string
+		args  []string
+		check func(t *testing.T, c *Config)
+		err   string
+	}{
+		{
+			name: "defaults",
+			args: []string{"-model", "jetsam.json"},
+			check: func(t *testing.T, c *Config) {
+				want := Defaults()
+				want.Model = "jetsam.json"
+				if !reflect.DeepEqual(c, want) {
+					t.Errorf("config = %+v, want %+v", c, want)
+				}
+			},
+		},
+		{
+			name: "file",
+			file: testConfigFile,
+			check: func(t *testing.T, c *Config) {
+				if c.Listen != ":9090" || c.Database.Host != "db" || c.Database.Name != "postgres" || c.Database.SSLMode != "require" {
+					t.Errorf("file did not layer over the defaults: %+v", c)
+				}
+				if len(c.Chains) != 2 || time.Duration(c.Chains[0].PollInterval) != 30*time.Second || c.DefaultContract().Label != "jetsam" {
+					t.Errorf("chains and contracts = %+v %+v", c.Chains, c.Contracts)
+				}
+			},
+		},
+		{
+			name: "environment",
+			file: testConfigFile,
+			env: map[string]string{
+				"LISTEN_ADDR":   ":7070",
+				"DB_PASSWORD":   "secret",
+				"DB_PORT":       "6543",
+				"POLL_INTERVAL": "5s",
+				"ENDPOINT":      "http://127.0.0.1:8545",
+				"APP_NAME":      "indexer",
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.Listen != ":7070" || c.Database.Host != "db" || c.Database.Password != "secret" || c.Database.Port != 6543 || c.Telemetry.AppName != "indexer" {
+					t.Errorf("environment did not layer over the file: %+v", c)
+				}
+				for _, ch := range c.Chains {
+					if time.Duration(ch.PollInterval) != 5*time.Second {
+						t.Errorf("chain %d poll_interval = %v, want 5s", ch.ID, time.Duration(ch.PollInterval))
+					}
+				}
+				if want := []string{"http://127.0.0.1:8545", "http://localhost:8545"}; !reflect.DeepEqual(c.Chains[0].Endpoints, want) {
+					t.Errorf("endpoints = %v, want %v", c.Chains[0].Endpoints, want)
+				}
+			},
+		},
+		{
+			name: "flags",
+			file: testConfigFile,
+			env:  map[string]string{"LISTEN_ADDR": ":7070", "DB_DSN": "postgres://env/db"},
+			args: []string{"-listen", ":6060", "-db-dsn", "postgres://flag/db", "-chain-id", "8453", "-address", "0x0000000000000000000000000000000000000001", "-endpoint", "https://base.example.com"},
+			check: func(t *testing.T, c *Config) {
+				if c.Listen != ":6060" || c.Database.DSN != "postgres://flag/db" || c.DefaultChain != 8453 || c.Default != "0x0000000000000000000000000000000000000001" {
+					t.Errorf("flags did not layer over the environment: %+v", c)
+				}
+				if want := []string{"https://base.example.com", "https://mainnet.base.org"}; !reflect.DeepEqual(c.Chains[1].Endpoints, want) {
+					t.Errorf("endpoints = %v, want %v", c.Chains[1].Endpoints, want)
+				}
+			},
+		},
+		{
+			name: "unset flags keep the environment",
+			file: testConfigFile,
+			env:  map[string]string{"LISTEN_ADDR": ":7070"},
+			args: []string{"-chain-id", "31337"},
+			check: func(t *testing.T, c *Config) {
+				if c.Listen != ":7070" {
+					t.Errorf("listen = %q, want :7070", c.Listen)
+				}
+			},
+		},
+		{
+			name: "endpoint declares the chain",
+			env:  map[string]string{"CHAIN_ID": "10", "CONTRACT_ADDRESS": "0x5FbDB2315678afecb367f032d93F642f64180aa3", "ENDPOINT": "https://optimism.example.com"},
+			check: func(t *testing.T, c *Config) {
+				want := []Chain{{ID: 10, Name: "10", Endpoints: []string{"https://optimism.example.com"}, PollInterval: Duration(time.Minute)}}
+				if !reflect.DeepEqual(c.Chains, want) {
+					t.Errorf("chains = %+v, want %+v", c.Chains, want)
+				}
+			},
+		},
+		{
+			name: "unknown field",
+			file: "listen: \":9090\"\nlisen: \":9091\"\n",
+			err:  "$CONFIG: yaml: unmarshal errors:\n  line 2: field lisen not found in type config.Config",
+		},
+		{
+			name: "bad port",
+			env:  map[string]string{"DB_PORT": "postgres"},
+			err:  `DB_PORT: strconv.Atoi: parsing "postgres": invalid syntax`,
+		},
+		{
+			name: "bad poll interval",
+			env:  map[string]string{"POLL_INTERVAL": "often"},
+			err:  `POLL_INTERVAL: time: invalid duration "often"`,
+		},
+		{
+			name: "invalid",
+			args: []string{"-listen", ""},
+			err:  "invalid config:\nlisten address is required\na default contract is required (default_contract, CONTRACT_ADDRESS or contracts)\ndefault chain 0 is not configured",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			var path string
+			if tc.file != "" {
+				path = filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, []byte(tc.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv("CONFIG_FILE", path)
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags := Bind(fs)
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			c, err := flags.Load()
+			if tc.err != "" {
+				if want := strings.ReplaceAll(tc.err, "$CONFIG", path); err == nil || err.Error() != want {
+					t.Fatalf("err = %v, want %q", err, want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.check(t, c)
+		})
+	}
+}
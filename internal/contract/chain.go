@@ -0,0 +1,184 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Chain is an EVM network followed by the indexer, endpoints are tried in order.
+type Chain struct {
+	ID                  int64    `json:"chain_id"`
+	Name                string   `json:"name"`
+	Endpoints           []string `json:"endpoints,omitempty"`
+	Confirmations       int      `json:"confirmations"`
+	PollIntervalSeconds int      `json:"poll_interval_seconds"`
+}
+
+func (c Chain) PollInterval() time.Duration {
+	return time.Duration(c.PollIntervalSeconds) * time.Second
+}
+
+// Deployment identifies a model contract on a chain.
+type Deployment struct {
+	ChainID int64          `json:"chain_id"`
+	Address common.Address `json:"address"`
+}
+
+func (d Deployment) String() string {
+	return fmt.Sprintf("%d/%s", d.ChainID, d.Address.Hex())
+}
+
+// Caller binds the read-only contract on the deployment's chain.
+func (d Deployment) Caller() (*MetamodelCaller, error) {
+	c, err := Dial(d.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	return NewMetamodelCaller(d.Address, c)
+}
+
+// Filterer binds the contract's event logs on the deployment's chain.
+func (d Deployment) Filterer() (*MetamodelFilterer, error) {
+	c, err := Dial(d.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	return NewMetamodelFilterer(d.Address, c)
+}
+
+var (
+	chainsMu sync.RWMutex
+	chains   = map[int64]*Chain{}
+	clients  = map[int64]*ethclient.Client{}
+)
+
+// AddChain registers or replaces a chain. An existing connection is forgotten so the next Dial
+// uses the new endpoints, it is not closed because callers that dialed it may still be using it.
+func AddChain(c Chain) {
+	chainsMu.Lock()
+	defer chainsMu.Unlock()
+	chains[c.ID] = &c
+	delete(clients, c.ID)
+}
+
+// RemoveChain forgets a chain and its connection, leaving it open for callers still using it.
+func RemoveChain(id int64) {
+	chainsMu.Lock()
+	defer chainsMu.Unlock()
+	delete(chains, id)
+	delete(clients, id)
+}
+
+func GetChain(id int64) (*Chain, bool) {
+	chainsMu.RLock()
+	defer chainsMu.RUnlock()
+	c, ok := chains[id]
+	return c, ok
+}
+
+func Chains() []Chain {
+	chainsMu.RLock()
+	defer chainsMu.RUnlock()
+	out := make([]Chain, 0, len(chains))
+	for _, c := range chains {
+		out = append(out, *c)
+	}
+	return out
+}
+
+// Dial returns a connected client for the chain, trying each endpoint until one answers with the expected chain ID.
+func Dial(id int64) (*ethclient.Client, error) {
+	chainsMu.RLock()
+	c, ok := clients[id]
+	chain, known := chains[id]
+	chainsMu.RUnlock()
+	if ok {
+		return c, nil
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown chain %d", id)
+	}
+
+	var lastErr error
+	for _, endpoint := range chain.Endpoints {
+		c, err := dialVerified(endpoint, id)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		chainsMu.Lock()
+		if existing, ok := clients[id]; ok {
+			chainsMu.Unlock()
+			c.Close()
+			return existing, nil
+		}
+		clients[id] = c
+		chainsMu.Unlock()
+		return c, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no endpoints configured")
+	}
+	return nil, fmt.Errorf("chain %d (%s): %w", id, chain.Name, lastErr)
+}
+
+// dialVerified connects to endpoint and checks its chain ID. Errors name the endpoint by scheme
+// and host only, they reach HTTP clients and endpoint URLs may embed API keys.
+func dialVerified(endpoint string, id int64) (*ethclient.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := ethclient.DialContext(ctx, endpoint)
+	if err != nil {
+		return nil, endpointError(endpoint, err)
+	}
+	actual, err := c.ChainID(ctx)
+	if err != nil {
+		c.Close()
+		return nil, endpointError(endpoint, err)
+	}
+	if actual.Int64() != id {
+		c.Close()
+		return nil, fmt.Errorf("%w: endpoint %s reports eth_chainId %d, expected %d", ErrChainMismatch, redactEndpoint(endpoint), actual.Int64(), id)
+	}
+	return c, nil
+}
+
+// redactEndpoint keeps the scheme and host of an endpoint URL, paths, queries and credentials often hold API keys.
+func redactEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "endpoint"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// endpointError replaces the endpoint URL in err, client errors usually quote it.
+func endpointError(endpoint string, err error) error {
+	redacted := redactEndpoint(endpoint)
+	return fmt.Errorf("endpoint %s: %s", redacted, strings.ReplaceAll(err.Error(), endpoint, redacted))
+}
+
+// ErrChainMismatch means an endpoint is serving a different chain than it was configured for.
+var ErrChainMismatch = errors.New("chain id mismatch")
+
+// Verify connects to every registered chain and checks eth_chainId, it is called at startup.
+// A mismatched chain ID is an error, an unreachable chain is only logged and dialed again on first use.
+func Verify() error {
+	for _, c := range Chains() {
+		_, err := Dial(c.ID)
+		if errors.Is(err, ErrChainMismatch) {
+			return err
+		} else if err != nil {
+			log.Printf("chain %d (%s) unavailable: %v", c.ID, c.Name, err)
+		}
+	}
+	return nil
+}
@@ -1,26 +1,15 @@
 package contract
 
 import (
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
-	"log"
 )
 
 var (
-	client   *ethclient.Client
-	err      error
-	Address  common.Address
-	Endpoint string
+	Address common.Address
+	ChainID int64
 )
 
-func Backend() bind.ContractBackend {
-	return client
-}
-
-func Connect() {
-	client, err = ethclient.Dial(Endpoint)
-	if err != nil {
-		log.Fatalf("Failed to connect to the Ethereum client: %v", err)
-	}
+// Default is the contract served by the unprefixed /v0 routes.
+func Default() Deployment {
+	return Deployment{ChainID: ChainID, Address: Address}
 }
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"time"
+)
+
+// FrameDelay is how long each frame of an animation is shown by default.
+const FrameDelay = 800 * time.Millisecond
+
+// Frame is the marking after one signal, Firing names the transition that produced it.
+type Frame struct {
+	State   []int64
+	Firing  string
+	Caption string
+}
+
+// frameOptions draws a frame on top of the shared options, such as role colors.
+func frameOptions(opts SvgOptions, f Frame) SvgOptions {
+	opts.State, opts.Firing, opts.Caption = f.State, f.Firing, f.Caption
+	return opts
+}
+
+// EncodeAnimatedSvg stacks one drawing per frame and shows them in turn with SMIL,
+// so browsers play it without scripts. The animation loops.
+func EncodeAnimatedSvg(decl contract.DeclarationPetriNet, frames []Frame, opts SvgOptions, delay time.Duration) ([]byte, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frames to animate")
+	}
+	if delay <= 0 {
+		delay = FrameDelay
+	}
+	type scene struct {
+		width, height float64
+		shapes        []svgShape
+	}
+	scenes := make([]scene, len(frames))
+	var width, height float64
+	for i, f := range frames {
+		w, h, shapes := svgScene(decl, frameOptions(opts, f))
+		scenes[i] = scene{w, h, shapes}
+		width, height = max(width, w), max(height, h)
+	}
+
+	total := delay.Seconds() * float64(len(frames))
+	var out bytes.Buffer
+	writeSvgHeader(&out, width, height)
+	for i, s := range scenes {
+		start, end := float64(i)/float64(len(frames)), float64(i+1)/float64(len(frames))
+		values, keyTimes := "hidden;visible;hidden", fmt.Sprintf("0;%g;%g", start, end)
+		switch {
+		case len(frames) == 1:
+			values, keyTimes = "visible", "0"
+		case i == 0:
+			values, keyTimes = "visible;hidden", fmt.Sprintf("0;%g", end)
+		case i == len(frames)-1:
+			values, keyTimes = "hidden;visible", fmt.Sprintf("0;%g", start)
+		}
+		fmt.Fprintf(&out, `<g class="frame" visibility="hidden"><animate attributeName="visibility" values="%s" keyTimes="%s" dur="%gs" calcMode="discrete" repeatCount="indefinite"/>`+"\n",
+			values, keyTimes, total)
+		for _, shape := range s.shapes {
+			writeSvgShape(&out, shape)
+			out.WriteString("\n")
+		}
+		out.WriteString("</g>\n")
+	}
+	out.WriteString("</svg>\n")
+	return out.Bytes(), nil
+}
+
+// EncodeGif rasterizes every frame into a looping GIF.
+func EncodeGif(decl contract.DeclarationPetriNet, frames []Frame, opts SvgOptions, delay time.Duration) ([]byte, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frames to animate")
+	}
+	if delay <= 0 {
+		delay = FrameDelay
+	}
+	images := make([]*image.RGBA, len(frames))
+	var bounds image.Rectangle
+	for i, f := range frames {
+		images[i] = Rasterize(decl, frameOptions(opts, f))
+		bounds = bounds.Union(images[i].Bounds())
+	}
+	anim := &gif.GIF{Config: image.Config{ColorModel: color.Palette(palette.Plan9), Width: bounds.Dx(), Height: bounds.Dy()}}
+	for _, img := range images {
+		frame := image.NewPaletted(bounds, palette.Plan9)
+		draw.Draw(frame, bounds, image.White, image.Point{}, draw.Src)
+		// no dithering, flat colors and text stay crisp
+		draw.Draw(frame, img.Bounds(), img, image.Point{}, draw.Src)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, int(delay/(10*time.Millisecond)))
+	}
+	var out bytes.Buffer
+	if err := gif.EncodeAll(&out, anim); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
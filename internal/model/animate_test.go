@@ -0,0 +1,85 @@
+package model
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestAnimatedSvgKeyTimes(t *testing.T) {
+	jetsam := readJetsam(t)
+	animate := regexp.MustCompile(`<animate attributeName="visibility" values="([^"]*)" keyTimes="([^"]*)" dur="([^"]*)"`)
+	for _, tc := range []struct {
+		name   string
+		frames int
+		delay  time.Duration
+		want   [][]string // values, keyTimes and dur of each frame
+	}{
+		{name: "one", frames: 1, want: [][]string{{"visible", "0", "0.8s"}}},
+		{name: "two", frames: 2, delay: time.Second, want: [][]string{
+			{"visible;hidden", "0;0.5", "2s"},
+			{"hidden;visible", "0;0.5", "2s"},
+		}},
+		{name: "four", frames: 4, want: [][]string{
+			{"visible;hidden", "0;0.25", "3.2s"},
+			{"hidden;visible;hidden", "0;0.25;0.5", "3.2s"},
+			{"hidden;visible;hidden", "0;0.5;0.75", "3.2s"},
+			{"hidden;visible", "0;0.75", "3.2s"},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := EncodeAnimatedSvg(jetsam, make([]Frame, tc.frames), SvgOptions{}, tc.delay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][]string
+			for _, m := range animate.FindAllStringSubmatch(string(out), -1) {
+				got = append(got, m[1:])
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("frames = %v, want %v", got, tc.want)
+			}
+		})
+	}
+	if _, err := EncodeAnimatedSvg(jetsam, nil, SvgOptions{}, 0); err == nil || err.Error() != "no frames to animate" {
+		t.Errorf("err = %v, want no frames to animate", err)
+	}
+}
+
+func TestEncodeGifSize(t *testing.T) {
+	jetsam := readJetsam(t)
+	// the caption makes the first frame taller, every frame takes the size of the largest
+	frames := []Frame{{State: jetsamState(jetsam), Firing: "breathe_o2", Caption: "block 1"}, {Firing: "burn_candle"}}
+	out, err := EncodeGif(jetsam, frames, SvgOptions{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	width, height, _ := svgScene(jetsam, frameOptions(SvgOptions{}, frames[0]))
+	if _, plain, _ := svgScene(jetsam, SvgOptions{}); plain >= height {
+		t.Fatalf("captioned frame is %g high, not taller than %g", height, plain)
+	}
+	scale := rasterScale(width, height, 1)
+	want := image.Rect(0, 0, rasterSide(width, scale), rasterSide(height, scale))
+	if anim.Config.Width != want.Dx() || anim.Config.Height != want.Dy() {
+		t.Errorf("gif is %dx%d, want %dx%d", anim.Config.Width, anim.Config.Height, want.Dx(), want.Dy())
+	}
+	if len(anim.Image) != len(frames) {
+		t.Fatalf("%d frames, want %d", len(anim.Image), len(frames))
+	}
+	for i, img := range anim.Image {
+		if img.Bounds() != want {
+			t.Errorf("frame %d is %v, want %v", i, img.Bounds(), want)
+		}
+		if anim.Delay[i] != 80 {
+			t.Errorf("frame %d delay %d, want 80", i, anim.Delay[i])
+		}
+	}
+}
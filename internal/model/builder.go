@@ -0,0 +1,157 @@
+package model
+
+import (
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math/big"
+)
+
+// Builder authors a model in Go with the vocabulary of the Solidity IPflowDSL.
+// Like the contract, every place is declared before the first transition so the
+// Properties and Actions enums keep declaration order. The first error is kept
+// and returned by Declaration, Model and Json, so calls can be chained.
+type Builder struct {
+	decl        contract.DeclarationPetriNet
+	places      map[string]int
+	transitions map[string]int
+	arcs        map[[3]string]bool
+	err         error
+}
+
+func NewBuilder() *Builder {
+	return &Builder{
+		places:      map[string]int{},
+		transitions: map[string]int{},
+		arcs:        map[[3]string]bool{},
+	}
+}
+
+// Position is a grid position, as Model.Position in Solidity.
+func Position(x, y uint8) contract.ModelPosition {
+	return contract.ModelPosition{X: x, Y: y}
+}
+
+func (b *Builder) fail(format string, args ...any) *Builder {
+	if b.err == nil {
+		b.err = fmt.Errorf(format, args...)
+	}
+	return b
+}
+
+func (b *Builder) declared(label string) bool {
+	_, place := b.places[label]
+	_, transition := b.transitions[label]
+	return place || transition
+}
+
+// Cell declares a place, a capacity of 0 is unbounded.
+func (b *Builder) Cell(label string, initial, capacity int64, pos contract.ModelPosition) *Builder {
+	switch {
+	case label == "":
+		return b.fail("cell: empty label")
+	case b.declared(label):
+		return b.fail("cell %s: label declared twice", label)
+	case len(b.decl.Transitions) > 0:
+		return b.fail("cell %s: places must be declared before transitions", label)
+	case initial < 0 || capacity < 0:
+		return b.fail("cell %s: initial and capacity must be >= 0", label)
+	case capacity > 0 && initial > capacity:
+		return b.fail("cell %s: initial %d exceeds capacity %d", label, initial, capacity)
+	}
+	b.places[label] = len(b.decl.Places)
+	b.decl.Places = append(b.decl.Places, contract.Declarationplace{
+		Label:    label,
+		X:        pos.X,
+		Y:        pos.Y,
+		Initial:  big.NewInt(initial),
+		Capacity: big.NewInt(capacity),
+	})
+	return b
+}
+
+// Func declares a transition, its action number is its declaration order.
+func (b *Builder) Func(label string, role uint8, pos contract.ModelPosition) *Builder {
+	switch {
+	case label == "":
+		return b.fail("func: empty label")
+	case b.declared(label):
+		return b.fail("func %s: label declared twice", label)
+	}
+	b.transitions[label] = len(b.decl.Transitions)
+	b.decl.Transitions = append(b.decl.Transitions, contract.Declarationtransition{
+		Label: label,
+		X:     pos.X,
+		Y:     pos.Y,
+		Role:  role,
+	})
+	return b
+}
+
+// Arrow moves tokens: from a place it consumes weight tokens, to a place it produces them.
+func (b *Builder) Arrow(weight int64, from, to string) *Builder {
+	return b.arc("arrow", weight, from, to, false)
+}
+
+// Guard inhibits a transition: from a place it blocks while the place holds more than weight tokens,
+// to a place it blocks until the place holds weight tokens.
+func (b *Builder) Guard(weight int64, from, to string) *Builder {
+	return b.arc("guard", weight, from, to, true)
+}
+
+func (b *Builder) arc(kind string, weight int64, from, to string, inhibit bool) *Builder {
+	// an arrow sets the transition's delta for the place and a guard its guard, so each is set once
+	key := [3]string{kind, from, to}
+	_, fromPlace := b.places[from]
+	_, toPlace := b.places[to]
+	_, fromTransition := b.transitions[from]
+	_, toTransition := b.transitions[to]
+	switch {
+	case !b.declared(from):
+		return b.fail("%s %s -> %s: unknown label %s", kind, from, to, from)
+	case !b.declared(to):
+		return b.fail("%s %s -> %s: unknown label %s", kind, from, to, to)
+	case !(fromPlace && toTransition || fromTransition && toPlace):
+		return b.fail("%s %s -> %s: arcs join a place and a transition", kind, from, to)
+	case weight <= 0:
+		return b.fail("%s %s -> %s: weight must be > 0", kind, from, to)
+	}
+	if toPlace {
+		key[1], key[2] = to, from
+	}
+	if b.arcs[key] {
+		article := map[string]string{"arrow": "an", "guard": "a"}[kind]
+		return b.fail("%s %s -> %s: %s and %s already share %s %s", kind, from, to, key[1], key[2], article, kind)
+	}
+	b.arcs[key] = true
+	b.decl.Arcs = append(b.decl.Arcs, contract.Declarationarc{
+		Source:  from,
+		Target:  to,
+		Weight:  big.NewInt(weight),
+		Consume: fromPlace,
+		Produce: toPlace,
+		Inhibit: inhibit,
+		Read:    inhibit && toPlace,
+	})
+	return b
+}
+
+// Declaration is the model as the contract's declaration() returns it.
+func (b *Builder) Declaration() (contract.DeclarationPetriNet, error) {
+	return b.decl, b.err
+}
+
+// Model is the model as the contract's model() returns it, with delta and guard vectors.
+func (b *Builder) Model() (contract.ModelPetriNet, error) {
+	if b.err != nil {
+		return contract.ModelPetriNet{}, b.err
+	}
+	return Compile(b.decl)
+}
+
+// Json is the model as pflow v0 JSON.
+func (b *Builder) Json() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return EncodeJson(b.decl)
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		build func(b *Builder)
+		err   string
+	}{
+		{
+			name: "valid",
+			build: func(b *Builder) {
+				b.Cell("a", 1, 0, Position(0, 0)).Cell("b", 0, 1, Position(2, 0)).Func("move", 0, Position(1, 0)).
+					Arrow(1, "a", "move").Arrow(1, "move", "b").Guard(1, "b", "move")
+			},
+		},
+		{
+			name:  "empty cell",
+			build: func(b *Builder) { b.Cell("", 0, 0, Position(0, 0)) },
+			err:   "cell: empty label",
+		},
+		{
+			name:  "cell twice",
+			build: func(b *Builder) { b.Cell("a", 0, 0, Position(0, 0)).Cell("a", 0, 0, Position(1, 0)) },
+			err:   "cell a: label declared twice",
+		},
+		{
+			name:  "cell after func",
+			build: func(b *Builder) { b.Func("move", 0, Position(0, 0)).Cell("a", 0, 0, Position(1, 0)) },
+			err:   "cell a: places must be declared before transitions",
+		},
+		{
+			name:  "over capacity",
+			build: func(b *Builder) { b.Cell("a", 2, 1, Position(0, 0)) },
+			err:   "cell a: initial 2 exceeds capacity 1",
+		},
+		{
+			name:  "func twice",
+			build: func(b *Builder) { b.Cell("a", 0, 0, Position(0, 0)).Func("a", 0, Position(1, 0)) },
+			err:   "func a: label declared twice",
+		},
+		{
+			name:  "unknown label",
+			build: func(b *Builder) { b.Func("move", 0, Position(0, 0)).Arrow(1, "a", "move") },
+			err:   "arrow a -> move: unknown label a",
+		},
+		{
+			name: "place to place",
+			build: func(b *Builder) {
+				b.Cell("a", 0, 0, Position(0, 0)).Cell("b", 0, 0, Position(1, 0)).Arrow(1, "a", "b")
+			},
+			err: "arrow a -> b: arcs join a place and a transition",
+		},
+		{
+			name: "zero weight",
+			build: func(b *Builder) {
+				b.Cell("a", 0, 0, Position(0, 0)).Func("move", 0, Position(1, 0)).Guard(0, "a", "move")
+			},
+			err: "guard a -> move: weight must be > 0",
+		},
+		{
+			name: "arrow twice",
+			build: func(b *Builder) {
+				b.Cell("a", 0, 0, Position(0, 0)).Func("move", 0, Position(1, 0)).Arrow(1, "a", "move").Arrow(1, "move", "a")
+			},
+			err: "arrow move -> a: a and move already share an arrow",
+		},
+		{
+			name: "guard twice",
+			build: func(b *Builder) {
+				b.Cell("a", 0, 0, Position(0, 0)).Func("move", 0, Position(1, 0)).Guard(1, "a", "move").Guard(2, "a", "move")
+			},
+			err: "guard a -> move: a and move already share a guard",
+		},
+		{
+			name: "first error kept",
+			build: func(b *Builder) {
+				b.Cell("", 0, 0, Position(0, 0)).Cell("a", 0, 0, Position(0, 0)).Cell("a", 0, 0, Position(0, 0))
+			},
+			err: "cell: empty label",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewBuilder()
+			tc.build(b)
+			_, err := b.Model()
+			if tc.err == "" && err != nil || tc.err != "" && (err == nil || err.Error() != tc.err) {
+				t.Errorf("err = %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestBuilderModel(t *testing.T) {
+	net, err := NewBuilder().
+		Cell("a", 1, 0, Position(0, 0)).Cell("b", 0, 1, Position(2, 0)).
+		Func("move", 0, Position(1, 0)).
+		Arrow(2, "a", "move").Arrow(1, "move", "b").Guard(1, "move", "b").
+		Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+	move := net.Transitions[0]
+	if move.Delta[0].Int64() != -2 || move.Delta[1].Int64() != 1 || move.Guard[1].Int64() != 1 {
+		t.Errorf("delta %v guard %v", move.Delta, move.Guard)
+	}
+}
@@ -0,0 +1,191 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// typedNames are the identifiers of a model's places, transitions and roles, in offset order,
+// so constants always match ModelEnums on chain.
+type typedNames struct {
+	Properties, PropertyLabels []string
+	Actions, ActionLabels      []string
+	Roles                      []string
+	ActionRoles                []uint8
+}
+
+func modelNames(net contract.ModelPetriNet, roles []string) (typedNames, error) {
+	var names typedNames
+	for i, p := range net.Places {
+		if int(p.Offset) != i {
+			return names, fmt.Errorf("place %s: offset %d out of order", p.Label, p.Offset)
+		}
+		names.Properties = append(names.Properties, camelCase(p.Label))
+		names.PropertyLabels = append(names.PropertyLabels, p.Label)
+	}
+	maxRole := 0
+	for i, t := range net.Transitions {
+		if int(t.Offset) != i {
+			return names, fmt.Errorf("transition %s: offset %d out of order", t.Label, t.Offset)
+		}
+		names.Actions = append(names.Actions, camelCase(t.Label))
+		names.ActionLabels = append(names.ActionLabels, t.Label)
+		names.ActionRoles = append(names.ActionRoles, t.Role)
+		maxRole = max(maxRole, int(t.Role))
+	}
+	for _, role := range RoleNames(maxRole, roles) {
+		names.Roles = append(names.Roles, camelCase(strings.ToLower(role)))
+	}
+	for kind, ids := range map[string][]string{"property": names.Properties, "action": names.Actions, "role": names.Roles} {
+		seen := map[string]bool{}
+		for _, id := range ids {
+			if seen[id] {
+				return names, fmt.Errorf("two %s labels are both named %s in code", kind, id)
+			}
+			seen[id] = true
+		}
+	}
+	return names, nil
+}
+
+// camelCase turns make_hot_air_baloon into MakeHotAirBaloon, labels starting with a digit get an N.
+func camelCase(label string) string {
+	var out strings.Builder
+	upper := true
+	for _, r := range label {
+		switch {
+		case r == '_' || r == '-' || r == ' ' || r == '.':
+			upper = true
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if out.Len() == 0 && unicode.IsDigit(r) {
+				out.WriteRune('N')
+			}
+			if upper {
+				r = unicode.ToUpper(r)
+			}
+			out.WriteRune(r)
+			upper = false
+		}
+	}
+	if out.Len() == 0 {
+		return "Unnamed"
+	}
+	return out.String()
+}
+
+// EncodeGo writes a Go package with typed Action, Property and Role constants for a model
+// and a Client with a SignalX method for each action over contract.MetamodelTransactor.
+// The package imports this module's contract package, so it must live inside the module.
+func EncodeGo(net contract.ModelPetriNet, pkg string, roles []string, source string) ([]byte, error) {
+	names, err := modelNames(net, roles)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by codegen from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	out.WriteString("import (\n")
+	out.WriteString("\t\"github.com/ethereum/go-ethereum/accounts/abi/bind\"\n")
+	out.WriteString("\t\"github.com/ethereum/go-ethereum/common\"\n")
+	out.WriteString("\t\"github.com/ethereum/go-ethereum/core/types\"\n")
+	out.WriteString("\t\"github.com/stackdump/on-chain-summer-2024/internal/contract\"\n")
+	out.WriteString("\t\"math/big\"\n")
+	out.WriteString("\t\"strconv\"\n")
+	out.WriteString(")\n\n")
+
+	writeGoEnum(&out, "Property", "places, the index into the contract state", names.Properties, names.PropertyLabels)
+	fmt.Fprintf(&out, "// PropertySize is ModelEnums.Properties.SIZE, the length of the state vector.\nconst PropertySize = %d\n\n", len(names.Properties))
+	writeGoEnum(&out, "Action", "transitions, the action argument of signal", names.Actions, names.ActionLabels)
+	writeGoEnum(&out, "Role", "roles allowed to signal an action", names.Roles, RoleNames(len(names.Roles)-1, roles))
+
+	out.WriteString("// ActionRoles is the role of each action.\nvar ActionRoles = [...]Role{\n")
+	for i, role := range names.ActionRoles {
+		fmt.Fprintf(&out, "\tAction%s: Role%s,\n", names.Actions[i], names.Roles[role])
+	}
+	out.WriteString("}\n\n")
+
+	out.WriteString("// Client signals the model's actions on a deployed contract.\n")
+	out.WriteString("type Client struct {\n\ttransactor *contract.MetamodelTransactor\n}\n\n")
+	out.WriteString("func NewClient(address common.Address, backend bind.ContractTransactor) (*Client, error) {\n")
+	out.WriteString("\ttransactor, err := contract.NewMetamodelTransactor(address, backend)\n")
+	out.WriteString("\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+	out.WriteString("\treturn &Client{transactor: transactor}, nil\n}\n\n")
+	out.WriteString("func (c *Client) Signal(opts *bind.TransactOpts, action Action, scalar int64) (*types.Transaction, error) {\n")
+	out.WriteString("\treturn c.transactor.Signal(opts, uint8(action), big.NewInt(scalar))\n}\n\n")
+	out.WriteString("func (c *Client) SignalMany(opts *bind.TransactOpts, actions []Action, scalars []int64) (*types.Transaction, error) {\n")
+	out.WriteString("\tids := make([]uint8, len(actions))\n\tfor i, a := range actions {\n\t\tids[i] = uint8(a)\n\t}\n")
+	out.WriteString("\tvalues := make([]*big.Int, len(scalars))\n\tfor i, s := range scalars {\n\t\tvalues[i] = big.NewInt(s)\n\t}\n")
+	out.WriteString("\treturn c.transactor.SignalMany(opts, ids, values)\n}\n")
+	for i, action := range names.Actions {
+		fmt.Fprintf(&out, "\n// Signal%s signals %s once.\n", action, names.ActionLabels[i])
+		fmt.Fprintf(&out, "func (c *Client) Signal%s(opts *bind.TransactOpts) (*types.Transaction, error) {\n", action)
+		fmt.Fprintf(&out, "\treturn c.Signal(opts, Action%s, 1)\n}\n", action)
+	}
+	return format.Source(out.Bytes())
+}
+
+func writeGoEnum(out *bytes.Buffer, kind, doc string, ids, labels []string) {
+	fmt.Fprintf(out, "// %s numbers the model's %s.\ntype %s uint8\n\n", kind, doc, kind)
+	out.WriteString("const (\n")
+	for i, id := range ids {
+		fmt.Fprintf(out, "\t%s%s %s = %d\n", kind, id, kind, i)
+	}
+	out.WriteString(")\n\n")
+	fmt.Fprintf(out, "var %sLabels = [...]string{\n", strings.ToLower(kind[:1])+kind[1:])
+	for i, id := range ids {
+		fmt.Fprintf(out, "\t%s%s: %s,\n", kind, id, strconv.Quote(labels[i]))
+	}
+	out.WriteString("}\n\n")
+	fmt.Fprintf(out, "func (v %s) String() string {\n", kind)
+	fmt.Fprintf(out, "\tif int(v) < len(%sLabels) {\n\t\treturn %sLabels[v]\n\t}\n", strings.ToLower(kind[:1])+kind[1:], strings.ToLower(kind[:1])+kind[1:])
+	fmt.Fprintf(out, "\treturn \"%s(\" + strconv.Itoa(int(v)) + \")\"\n}\n\n", kind)
+}
+
+// EncodeTypeScript writes the TypeScript counterpart of EncodeGo: Action, Property and Role enums,
+// their labels, and a signal helper for each action over any contract with a signal method.
+func EncodeTypeScript(net contract.ModelPetriNet, roles []string, source string) ([]byte, error) {
+	names, err := modelNames(net, roles)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by codegen from %s. DO NOT EDIT.\n\n", source)
+	writeTsEnum(&out, "Property", names.Properties, names.PropertyLabels)
+	fmt.Fprintf(&out, "export const PropertySize = %d;\n\n", len(names.Properties))
+	writeTsEnum(&out, "Action", names.Actions, names.ActionLabels)
+	writeTsEnum(&out, "Role", names.Roles, RoleNames(len(names.Roles)-1, roles))
+
+	out.WriteString("export const ActionRoles: Record<Action, Role> = {\n")
+	for i, role := range names.ActionRoles {
+		fmt.Fprintf(&out, "  [Action.%s]: Role.%s,\n", names.Actions[i], names.Roles[role])
+	}
+	out.WriteString("};\n\n")
+
+	out.WriteString("export interface Signaler<T> {\n")
+	out.WriteString("  signal(action: number, scalar: number | bigint): Promise<T>;\n")
+	out.WriteString("}\n")
+	for i, action := range names.Actions {
+		fmt.Fprintf(&out, "\n// signal%s signals %s.\n", action, names.ActionLabels[i])
+		fmt.Fprintf(&out, "export function signal%s<T>(contract: Signaler<T>, scalar: number | bigint = 1): Promise<T> {\n", action)
+		fmt.Fprintf(&out, "  return contract.signal(Action.%s, scalar);\n}\n", action)
+	}
+	return out.Bytes(), nil
+}
+
+func writeTsEnum(out *bytes.Buffer, kind string, ids, labels []string) {
+	fmt.Fprintf(out, "export enum %s {\n", kind)
+	for i, id := range ids {
+		fmt.Fprintf(out, "  %s = %d,\n", id, i)
+	}
+	out.WriteString("}\n\n")
+	fmt.Fprintf(out, "export const %sLabels: Record<%s, string> = {\n", kind, kind)
+	for i, id := range ids {
+		fmt.Fprintf(out, "  [%s.%s]: %s,\n", kind, id, strconv.Quote(labels[i]))
+	}
+	out.WriteString("};\n\n")
+}
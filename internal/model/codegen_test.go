@@ -0,0 +1,67 @@
+package model
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestCodegenGolden(t *testing.T) {
+	net, err := Compile(readJetsam(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := []string{"DEFAULT", "HALT"}
+	for _, tc := range []struct {
+		golden string
+		encode func() ([]byte, error)
+	}{
+		{golden: "jetsam.go.golden", encode: func() ([]byte, error) { return EncodeGo(net, "jetsam", roles, "jetsam.json") }},
+		{golden: "jetsam.ts.golden", encode: func() ([]byte, error) { return EncodeTypeScript(net, roles, "jetsam.json") }},
+	} {
+		t.Run(tc.golden, func(t *testing.T) {
+			out, err := tc.encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, tc.golden, out)
+		})
+	}
+}
+
+func TestCodegenGoParses(t *testing.T) {
+	net, err := Compile(readJetsam(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := EncodeGo(net, "jetsam", nil, "jetsam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "jetsam.go", out, parser.AllErrors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Name.Name != "jetsam" || len(file.Imports) != 6 {
+		t.Errorf("package %s with %d imports, want jetsam with 6", file.Name.Name, len(file.Imports))
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	for _, tc := range []struct {
+		label string
+		want  string
+	}{
+		{label: "make_hot_air_baloon", want: "MakeHotAirBaloon"},
+		{label: "breathe_o2", want: "BreatheO2"},
+		{label: "two words", want: "TwoWords"},
+		{label: "1st", want: "N1st"},
+		{label: "__", want: "Unnamed"},
+	} {
+		t.Run(tc.label, func(t *testing.T) {
+			if got := camelCase(tc.label); got != tc.want {
+				t.Errorf("camelCase(%q) = %q, want %q", tc.label, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math/big"
+)
+
+// Grid positions in a declaration are scaled to pixels for pflow.
+const (
+	Scale  = 80
+	Margin = 22
+)
+
+const (
+	kindPlace      = 0
+	kindTransition = 1
+)
+
+// Compile builds the executable model from a declaration the way the pflow DSL does on chain:
+// arrows set the delta vector, guards set the guard vector.
+func Compile(decl contract.DeclarationPetriNet) (contract.ModelPetriNet, error) {
+	var net contract.ModelPetriNet
+	places := map[string]uint8{}
+	transitions := map[string]uint8{}
+
+	for i, p := range decl.Places {
+		if _, ok := places[p.Label]; ok {
+			return net, fmt.Errorf("place %s declared twice", p.Label)
+		}
+		places[p.Label] = uint8(i)
+		net.Places = append(net.Places, contract.ModelPlace{
+			Label:    p.Label,
+			Offset:   uint8(i),
+			Position: contract.ModelPosition{X: p.X, Y: p.Y},
+			Initial:  bigOrZero(p.Initial),
+			Capacity: bigOrZero(p.Capacity),
+		})
+	}
+	for i, t := range decl.Transitions {
+		if _, ok := transitions[t.Label]; ok {
+			return net, fmt.Errorf("transition %s declared twice", t.Label)
+		}
+		if _, ok := places[t.Label]; ok {
+			return net, fmt.Errorf("%s is both a place and a transition", t.Label)
+		}
+		transitions[t.Label] = uint8(i)
+		net.Transitions = append(net.Transitions, contract.ModelTransition{
+			Label:    t.Label,
+			Offset:   uint8(i),
+			Position: contract.ModelPosition{X: t.X, Y: t.Y},
+			Role:     t.Role,
+			Delta:    zeros(len(decl.Places)),
+			Guard:    zeros(len(decl.Places)),
+		})
+	}
+
+	for _, a := range decl.Arcs {
+		weight := bigOrZero(a.Weight).Int64()
+		if weight <= 0 {
+			return net, fmt.Errorf("arc %s -> %s: weight must be > 0", a.Source, a.Target)
+		}
+		arc := contract.ModelArc{Weight: big.NewInt(weight), Inhibitor: a.Inhibit, Read: a.Read}
+		if p, ok := places[a.Source]; ok {
+			t, ok := transitions[a.Target]
+			if !ok {
+				return net, fmt.Errorf("arc %s -> %s: target must be a transition", a.Source, a.Target)
+			}
+			arc.Source = contract.ModelNode{Label: a.Source, Offset: p, Kind: kindPlace}
+			arc.Target = contract.ModelNode{Label: a.Target, Offset: t, Kind: kindTransition}
+			if a.Inhibit {
+				net.Transitions[t].Guard[p] = big.NewInt(-weight)
+			} else {
+				net.Transitions[t].Delta[p] = big.NewInt(-weight)
+			}
+		} else if t, ok := transitions[a.Source]; ok {
+			p, ok := places[a.Target]
+			if !ok {
+				return net, fmt.Errorf("arc %s -> %s: target must be a place", a.Source, a.Target)
+			}
+			arc.Source = contract.ModelNode{Label: a.Source, Offset: t, Kind: kindTransition}
+			arc.Target = contract.ModelNode{Label: a.Target, Offset: p, Kind: kindPlace}
+			if a.Inhibit {
+				net.Transitions[t].Guard[p] = big.NewInt(weight)
+			} else {
+				net.Transitions[t].Delta[p] = big.NewInt(weight)
+			}
+		} else {
+			return net, fmt.Errorf("arc %s -> %s: unknown source", a.Source, a.Target)
+		}
+		net.Arcs = append(net.Arcs, arc)
+	}
+	return net, nil
+}
+
+func zeros(n int) []*big.Int {
+	v := make([]*big.Int, n)
+	for i := range v {
+		v[i] = new(big.Int)
+	}
+	return v
+}
+
+func bigOrZero(v *big.Int) *big.Int {
+	if v == nil {
+		return new(big.Int)
+	}
+	return v
+}
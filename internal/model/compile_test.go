@@ -0,0 +1,94 @@
+package model
+
+import (
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math/big"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	place := func(label string) contract.Declarationplace {
+		return contract.Declarationplace{Label: label, Initial: big.NewInt(1), Capacity: big.NewInt(0)}
+	}
+	arc := func(source, target string, weight int64, inhibit bool) contract.Declarationarc {
+		return contract.Declarationarc{Source: source, Target: target, Weight: big.NewInt(weight), Inhibit: inhibit}
+	}
+	places := []contract.Declarationplace{place("a"), place("b")}
+	transitions := []contract.Declarationtransition{{Label: "move", Role: 1}}
+	for _, tc := range []struct {
+		name  string
+		decl  contract.DeclarationPetriNet
+		delta []int64
+		guard []int64
+		err   string
+	}{
+		{
+			name:  "arrows",
+			decl:  contract.DeclarationPetriNet{Places: places, Transitions: transitions, Arcs: []contract.Declarationarc{arc("a", "move", 2, false), arc("move", "b", 1, false)}},
+			delta: []int64{-2, 1},
+			guard: []int64{0, 0},
+		},
+		{
+			name:  "guards",
+			decl:  contract.DeclarationPetriNet{Places: places, Transitions: transitions, Arcs: []contract.Declarationarc{arc("a", "move", 3, true), arc("move", "b", 2, true)}},
+			delta: []int64{0, 0},
+			guard: []int64{-3, 2},
+		},
+		{
+			name: "place twice",
+			decl: contract.DeclarationPetriNet{Places: []contract.Declarationplace{place("a"), place("a")}},
+			err:  "place a declared twice",
+		},
+		{
+			name: "transition twice",
+			decl: contract.DeclarationPetriNet{Transitions: []contract.Declarationtransition{{Label: "move"}, {Label: "move"}}},
+			err:  "transition move declared twice",
+		},
+		{
+			name: "place and transition",
+			decl: contract.DeclarationPetriNet{Places: places, Transitions: []contract.Declarationtransition{{Label: "a"}}},
+			err:  "a is both a place and a transition",
+		},
+		{
+			name: "zero weight",
+			decl: contract.DeclarationPetriNet{Places: places, Transitions: transitions, Arcs: []contract.Declarationarc{arc("a", "move", 0, false)}},
+			err:  "arc a -> move: weight must be > 0",
+		},
+		{
+			name: "place to place",
+			decl: contract.DeclarationPetriNet{Places: places, Transitions: transitions, Arcs: []contract.Declarationarc{arc("a", "b", 1, false)}},
+			err:  "arc a -> b: target must be a transition",
+		},
+		{
+			name: "transition to transition",
+			decl: contract.DeclarationPetriNet{Places: places, Transitions: transitions, Arcs: []contract.Declarationarc{arc("move", "move", 1, false)}},
+			err:  "arc move -> move: target must be a place",
+		},
+		{
+			name: "unknown source",
+			decl: contract.DeclarationPetriNet{Places: places, Transitions: transitions, Arcs: []contract.Declarationarc{arc("c", "move", 1, false)}},
+			err:  "arc c -> move: unknown source",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			net, err := Compile(tc.decl)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("err = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(net.Arcs) != len(tc.decl.Arcs) || net.Transitions[0].Role != 1 {
+				t.Errorf("compiled %d arcs with role %d", len(net.Arcs), net.Transitions[0].Role)
+			}
+			for i := range tc.delta {
+				if d, g := net.Transitions[0].Delta[i].Int64(), net.Transitions[0].Guard[i].Int64(); d != tc.delta[i] || g != tc.guard[i] {
+					t.Errorf("place %d: delta %d guard %d, want %d %d", i, d, g, tc.delta[i], tc.guard[i])
+				}
+			}
+		})
+	}
+}
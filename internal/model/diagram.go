@@ -0,0 +1,127 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"strings"
+)
+
+// arcStyle names the three kinds of arc in a declaration.
+func arcStyle(a contract.Declarationarc) string {
+	switch {
+	case a.Inhibit && a.Read:
+		return "read"
+	case a.Inhibit:
+		return "inhibitor"
+	default:
+		return "normal"
+	}
+}
+
+// arcLabel shows weights other than 1, guards always show theirs.
+func arcLabel(a contract.Declarationarc) string {
+	weight := bigOrZero(a.Weight).Int64()
+	if weight == 1 && !a.Inhibit {
+		return ""
+	}
+	return fmt.Sprint(weight)
+}
+
+func placeLabel(decl contract.DeclarationPetriNet, i int, state []int64) string {
+	if state == nil || i >= len(state) {
+		return decl.Places[i].Label
+	}
+	return fmt.Sprintf("%s\n%d", decl.Places[i].Label, state[i])
+}
+
+// nodeIds gives places and transitions distinct ids, a label may name both.
+func nodeIds(decl contract.DeclarationPetriNet) map[string]string {
+	ids := map[string]string{}
+	for i, t := range decl.Transitions {
+		ids[t.Label] = fmt.Sprintf("t%d", i)
+	}
+	for i, p := range decl.Places {
+		ids[p.Label] = fmt.Sprintf("p%d", i)
+	}
+	return ids
+}
+
+// EncodeDot renders a declaration for Graphviz: places are circles, transitions boxes, pinned at their positions.
+// Inhibitor arcs are dashed with a circle head, read arcs dotted with a diamond head.
+// When state is not nil each place shows its token count.
+func EncodeDot(decl contract.DeclarationPetriNet, name string, state []int64) []byte {
+	ids := nodeIds(decl)
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "digraph %s {\n", dotString(name))
+	out.WriteString("  rankdir=LR;\n")
+	out.WriteString("  node [fontname=\"Helvetica\", fontsize=10];\n")
+	out.WriteString("  edge [fontname=\"Helvetica\", fontsize=9];\n")
+	for i, p := range decl.Places {
+		fmt.Fprintf(&out, "  p%d [shape=circle, label=%s, pos=%s];\n", i, dotString(placeLabel(decl, i, state)), dotPos(p.X, p.Y))
+	}
+	for i, t := range decl.Transitions {
+		fmt.Fprintf(&out, "  t%d [shape=box, label=%s, pos=%s];\n", i, dotString(t.Label), dotPos(t.X, t.Y))
+	}
+	for _, a := range decl.Arcs {
+		var attrs []string
+		if label := arcLabel(a); label != "" {
+			attrs = append(attrs, "label="+dotString(label))
+		}
+		switch arcStyle(a) {
+		case "inhibitor":
+			attrs = append(attrs, "style=dashed", "arrowhead=odot")
+		case "read":
+			attrs = append(attrs, "style=dotted", "arrowhead=diamond")
+		}
+		fmt.Fprintf(&out, "  %s -> %s", ids[a.Source], ids[a.Target])
+		if len(attrs) > 0 {
+			fmt.Fprintf(&out, " [%s]", strings.Join(attrs, ", "))
+		}
+		out.WriteString(";\n")
+	}
+	out.WriteString("}\n")
+	return out.Bytes()
+}
+
+// dotPos pins a node at its grid position in points for neato -n, Graphviz's y axis points up.
+func dotPos(x, y uint8) string {
+	return fmt.Sprintf(`"%d,%d!"`, toPixel(x, 0), -toPixel(y, Margin))
+}
+
+func dotString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// EncodeMermaid renders a declaration as a Mermaid flowchart for markdown: places are circles,
+// transitions boxes, inhibitor arcs end in a circle and read arcs are dotted.
+// When state is not nil each place shows its token count.
+func EncodeMermaid(decl contract.DeclarationPetriNet, state []int64) []byte {
+	ids := nodeIds(decl)
+	var out bytes.Buffer
+	out.WriteString("flowchart LR\n")
+	for i := range decl.Places {
+		fmt.Fprintf(&out, "  p%d((%s))\n", i, mermaidString(placeLabel(decl, i, state)))
+	}
+	for i, t := range decl.Transitions {
+		fmt.Fprintf(&out, "  t%d[%s]\n", i, mermaidString(t.Label))
+	}
+	for _, a := range decl.Arcs {
+		edge := "-->"
+		switch arcStyle(a) {
+		case "inhibitor":
+			edge = "--o"
+		case "read":
+			edge = "-.->"
+		}
+		if label := arcLabel(a); label != "" {
+			edge += "|" + label + "|"
+		}
+		fmt.Fprintf(&out, "  %s %s %s\n", ids[a.Source], edge, ids[a.Target])
+	}
+	return out.Bytes()
+}
+
+func mermaidString(s string) string {
+	return `"` + strings.NewReplacer(`"`, "#quot;", "\n", "<br/>").Replace(s) + `"`
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"bytes"
+	"flag"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func readJetsam(t *testing.T) contract.DeclarationPetriNet {
+	t.Helper()
+	data, err := os.ReadFile("testdata/jetsam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl, err := DecodeJson(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decl
+}
+
+// golden compares out with testdata/name, go test -update rewrites it after a reviewed change.
+func golden(t *testing.T, name string, out []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, want) {
+		got, want := bytes.Split(out, []byte("\n")), bytes.Split(want, []byte("\n"))
+		for i := 0; i < max(len(got), len(want)); i++ {
+			if i >= len(got) || i >= len(want) || !bytes.Equal(got[i], want[i]) {
+				t.Fatalf("%s differs at line %d:\ngot:  %q\nwant: %q", path, i+1, goldenLine(got, i), goldenLine(want, i))
+			}
+		}
+	}
+}
+
+func goldenLine(lines [][]byte, i int) []byte {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return []byte("<end of file>")
+}
+
+// jetsamState is a marking with a different count in every place.
+func jetsamState(decl contract.DeclarationPetriNet) []int64 {
+	state := make([]int64, len(decl.Places))
+	for i := range state {
+		state[i] = int64(i)
+	}
+	return state
+}
+
+func TestDiagramGolden(t *testing.T) {
+	jetsam := readJetsam(t)
+	for _, tc := range []struct {
+		golden string
+		encode func() []byte
+	}{
+		{golden: "jetsam.dot", encode: func() []byte { return EncodeDot(jetsam, "Jetsam", nil) }},
+		{golden: "jetsam.state.dot", encode: func() []byte { return EncodeDot(jetsam, "Jetsam", jetsamState(jetsam)) }},
+		{golden: "jetsam.mmd", encode: func() []byte { return EncodeMermaid(jetsam, nil) }},
+		{golden: "jetsam.state.mmd", encode: func() []byte { return EncodeMermaid(jetsam, jetsamState(jetsam)) }},
+	} {
+		t.Run(tc.golden, func(t *testing.T) {
+			golden(t, tc.golden, tc.encode())
+		})
+	}
+}
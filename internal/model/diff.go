@@ -0,0 +1,316 @@
+package model
+
+import (
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math/big"
+	"sort"
+)
+
+// Change is one difference between two declarations. Arcs are labelled "source -> target",
+// with "(inhibitor)" or "(read)" after guards.
+type Change struct {
+	Kind     string   `json:"kind"`   // place, transition or arc
+	Change   string   `json:"change"` // added, removed, renamed or changed
+	Label    string   `json:"label"`
+	OldLabel string   `json:"old_label,omitempty"`
+	Details  []string `json:"details,omitempty"`
+}
+
+// ModelDiff lists the changes from an old declaration to a new one. Signals only record the
+// action offset and state is read by place offset, so Compatible tells whether indexed history
+// replays to the same markings under the new model, Problems says why not.
+type ModelDiff struct {
+	Changes    []Change `json:"changes"`
+	Compatible bool     `json:"compatible"`
+	Problems   []string `json:"problems"`
+}
+
+// CompareModels diffs two declarations by label. A label that disappears while a new one
+// takes its offset is reported as renamed, positions are ignored.
+func CompareModels(before, after contract.DeclarationPetriNet) (*ModelDiff, error) {
+	beforeNet, err := Compile(before)
+	if err != nil {
+		return nil, fmt.Errorf("before model: %w", err)
+	}
+	afterNet, err := Compile(after)
+	if err != nil {
+		return nil, fmt.Errorf("after model: %w", err)
+	}
+	diff := &ModelDiff{Changes: []Change{}, Problems: []string{}}
+	problem := func(format string, args ...any) {
+		diff.Problems = append(diff.Problems, fmt.Sprintf(format, args...))
+	}
+
+	beforePlaces, afterPlaces := make([]string, len(before.Places)), make([]string, len(after.Places))
+	for i, p := range before.Places {
+		beforePlaces[i] = p.Label
+	}
+	for i, p := range after.Places {
+		afterPlaces[i] = p.Label
+	}
+	placeRenames := renames(beforePlaces, afterPlaces)
+	for _, c := range compareNodes("place", beforePlaces, afterPlaces, placeRenames) {
+		c.Details = append(c.Details, comparePlace(beforeNet, afterNet, c)...)
+		diff.add(c)
+	}
+	for i, label := range beforePlaces {
+		if i >= len(afterPlaces) {
+			problem("place %d %s was removed, state after it is read from the wrong offset", i, label)
+		} else if placeRenames[label] != afterPlaces[i] {
+			problem("place %d was %s and is now %s", i, label, afterPlaces[i])
+		}
+	}
+	for i, p := range beforeNet.Places {
+		if i < len(afterNet.Places) && p.Initial.Cmp(afterNet.Places[i].Initial) != 0 {
+			problem("place %s starts with %s tokens instead of %s", afterNet.Places[i].Label, afterNet.Places[i].Initial, p.Initial)
+		}
+		if i < len(afterNet.Places) && tighter(p.Capacity, afterNet.Places[i].Capacity) {
+			problem("place %s capacity %s is below %s, signals that fired before may overflow", afterNet.Places[i].Label, afterNet.Places[i].Capacity, p.Capacity)
+		}
+	}
+
+	beforeActions, afterActions := make([]string, len(before.Transitions)), make([]string, len(after.Transitions))
+	for i, t := range before.Transitions {
+		beforeActions[i] = t.Label
+	}
+	for i, t := range after.Transitions {
+		afterActions[i] = t.Label
+	}
+	actionRenames := renames(beforeActions, afterActions)
+	for _, c := range compareNodes("transition", beforeActions, afterActions, actionRenames) {
+		c.Details = append(c.Details, compareTransition(beforeNet, afterNet, c, placeRenames)...)
+		diff.add(c)
+	}
+	for i, label := range beforeActions {
+		switch {
+		case i >= len(afterActions):
+			problem("action %d %s was removed, its signals have no transition", i, label)
+		case actionRenames[label] != afterActions[i]:
+			problem("action %d was %s and is now %s", i, label, afterActions[i])
+		case !sameWeights(beforeNet, afterNet, beforeNet.Transitions[i], afterNet.Transitions[i], placeRenames):
+			problem("action %d %s changes different places or weights", i, afterActions[i])
+		}
+	}
+
+	diff.Changes = append(diff.Changes, compareArcs(before, after, placeRenames, actionRenames)...)
+	diff.Compatible = len(diff.Problems) == 0
+	return diff, nil
+}
+
+// add keeps every change except a node that is still there and unchanged.
+func (d *ModelDiff) add(c Change) {
+	if c.Change != "changed" || len(c.Details) > 0 {
+		d.Changes = append(d.Changes, c)
+	}
+}
+
+// renames maps every label before to its label after, labels kept by both map to themselves
+// and removed labels are missing.
+func renames(before, after []string) map[string]string {
+	kept := map[string]bool{}
+	for _, label := range after {
+		kept[label] = true
+	}
+	m := map[string]string{}
+	for i, label := range before {
+		if kept[label] {
+			m[label] = label
+		} else if i < len(after) && !containsLabel(before, after[i]) {
+			m[label] = after[i]
+		}
+	}
+	return m
+}
+
+func containsLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+func compareNodes(kind string, before, after []string, renamed map[string]string) []Change {
+	var changes []Change
+	afterOffset := map[string]int{}
+	for i, label := range after {
+		afterOffset[label] = i
+	}
+	matched := map[string]bool{}
+	for i, label := range before {
+		target, ok := renamed[label]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: kind, Change: "removed", Label: label, Details: []string{fmt.Sprintf("offset %d", i)}})
+		case target != label:
+			matched[target] = true
+			changes = append(changes, Change{Kind: kind, Change: "renamed", Label: target, OldLabel: label})
+		default:
+			matched[label] = true
+			c := Change{Kind: kind, Change: "changed", Label: label}
+			if j := afterOffset[label]; j != i {
+				c.Details = []string{fmt.Sprintf("offset %d -> %d", i, j)}
+			}
+			changes = append(changes, c)
+		}
+	}
+	for i, label := range after {
+		if !matched[label] {
+			changes = append(changes, Change{Kind: kind, Change: "added", Label: label, Details: []string{fmt.Sprintf("offset %d", i)}})
+		}
+	}
+	return changes
+}
+
+func findPlace(net contract.ModelPetriNet, label string) contract.ModelPlace {
+	for _, p := range net.Places {
+		if p.Label == label {
+			return p
+		}
+	}
+	return contract.ModelPlace{}
+}
+
+func findTransition(net contract.ModelPetriNet, label string) contract.ModelTransition {
+	for _, t := range net.Transitions {
+		if t.Label == label {
+			return t
+		}
+	}
+	return contract.ModelTransition{}
+}
+
+// comparePlace details the initial tokens and capacity of a kept or renamed place.
+func comparePlace(beforeNet, afterNet contract.ModelPetriNet, c Change) []string {
+	if c.Change != "changed" && c.Change != "renamed" {
+		return nil
+	}
+	beforeLabel := c.Label
+	if c.OldLabel != "" {
+		beforeLabel = c.OldLabel
+	}
+	o, n := findPlace(beforeNet, beforeLabel), findPlace(afterNet, c.Label)
+	var details []string
+	if o.Initial.Cmp(n.Initial) != 0 {
+		details = append(details, fmt.Sprintf("initial %s -> %s", o.Initial, n.Initial))
+	}
+	if o.Capacity.Cmp(n.Capacity) != 0 {
+		details = append(details, fmt.Sprintf("capacity %s -> %s", o.Capacity, n.Capacity))
+	}
+	return details
+}
+
+func compareTransition(beforeNet, afterNet contract.ModelPetriNet, c Change, placeRenames map[string]string) []string {
+	if c.Change != "changed" && c.Change != "renamed" {
+		return nil
+	}
+	beforeLabel := c.Label
+	if c.OldLabel != "" {
+		beforeLabel = c.OldLabel
+	}
+	o, n := findTransition(beforeNet, beforeLabel), findTransition(afterNet, c.Label)
+	var details []string
+	if o.Role != n.Role {
+		details = append(details, fmt.Sprintf("role %d -> %d", o.Role, n.Role))
+	}
+	if !sameWeights(beforeNet, afterNet, o, n, placeRenames) {
+		details = append(details, "weights changed")
+	}
+	return details
+}
+
+// sameWeights compares the delta and guard vectors of two actions, matching places through their renames.
+func sameWeights(beforeNet, afterNet contract.ModelPetriNet, o, t contract.ModelTransition, placeRenames map[string]string) bool {
+	beforeWeights := map[string][2]int64{}
+	for _, p := range beforeNet.Places {
+		label, ok := placeRenames[p.Label]
+		if !ok {
+			label = "removed " + p.Label
+		}
+		beforeWeights[label] = [2]int64{o.Delta[p.Offset].Int64(), o.Guard[p.Offset].Int64()}
+	}
+	afterWeights := map[string][2]int64{}
+	for _, p := range afterNet.Places {
+		afterWeights[p.Label] = [2]int64{t.Delta[p.Offset].Int64(), t.Guard[p.Offset].Int64()}
+	}
+	for label, w := range beforeWeights {
+		if afterWeights[label] != w {
+			return false
+		}
+	}
+	for label, w := range afterWeights {
+		if beforeWeights[label] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// tighter is true when the capacity after admits fewer tokens than before, 0 is unbounded.
+func tighter(before, after *big.Int) bool {
+	if after.Sign() == 0 {
+		return false
+	}
+	return before.Sign() == 0 || after.Cmp(before) < 0
+}
+
+// compareArcs matches arcs by their endpoints after renames and their kind. Parallel arcs
+// with the same key are paired in declaration order, the extra ones are added or removed.
+func compareArcs(before, after contract.DeclarationPetriNet, placeRenames, actionRenames map[string]string) []Change {
+	rename := func(label string) string {
+		if l, ok := placeRenames[label]; ok {
+			return l
+		}
+		if l, ok := actionRenames[label]; ok {
+			return l
+		}
+		return label
+	}
+	var keys []string
+	beforeArcs := map[string][]contract.Declarationarc{}
+	for _, a := range before.Arcs {
+		key := arcKey(rename(a.Source), rename(a.Target), a)
+		if beforeArcs[key] == nil {
+			keys = append(keys, key)
+		}
+		beforeArcs[key] = append(beforeArcs[key], a)
+	}
+	afterArcs := map[string][]contract.Declarationarc{}
+	for _, a := range after.Arcs {
+		key := arcKey(a.Source, a.Target, a)
+		if beforeArcs[key] == nil && afterArcs[key] == nil {
+			keys = append(keys, key)
+		}
+		afterArcs[key] = append(afterArcs[key], a)
+	}
+
+	var changes []Change
+	for _, key := range keys {
+		b, a := beforeArcs[key], afterArcs[key]
+		for i := 0; i < max(len(b), len(a)); i++ {
+			switch {
+			case i >= len(a):
+				changes = append(changes, Change{Kind: "arc", Change: "removed", Label: key})
+			case i >= len(b):
+				changes = append(changes, Change{Kind: "arc", Change: "added", Label: key})
+			case bigOrZero(b[i].Weight).Cmp(bigOrZero(a[i].Weight)) != 0:
+				changes = append(changes, Change{Kind: "arc", Change: "changed", Label: key, Details: []string{
+					fmt.Sprintf("weight %s -> %s", bigOrZero(b[i].Weight), bigOrZero(a[i].Weight)),
+				}})
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Label < changes[j].Label })
+	return changes
+}
+
+// arcKey labels an arc "source -> target", followed by its style when it is not a normal arc.
+func arcKey(source, target string, a contract.Declarationarc) string {
+	key := source + " -> " + target
+	if style := arcStyle(a); style != "normal" {
+		key += " (" + style + ")"
+	}
+	return key
+}
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func diffModel(places, transitions []string, arcs ...contract.Declarationarc) contract.DeclarationPetriNet {
+	var decl contract.DeclarationPetriNet
+	for _, label := range places {
+		decl.Places = append(decl.Places, contract.Declarationplace{Label: label, Initial: big.NewInt(0), Capacity: big.NewInt(0)})
+	}
+	for _, label := range transitions {
+		decl.Transitions = append(decl.Transitions, contract.Declarationtransition{Label: label})
+	}
+	decl.Arcs = arcs
+	return decl
+}
+
+func diffArc(source, target string, weight int64) contract.Declarationarc {
+	return contract.Declarationarc{Source: source, Target: target, Weight: big.NewInt(weight)}
+}
+
+func diffGuard(source, target string, weight int64) contract.Declarationarc {
+	a := diffArc(source, target, weight)
+	a.Inhibit = true
+	return a
+}
+
+func TestCompareModels(t *testing.T) {
+	before := diffModel([]string{"a", "b"}, []string{"move"}, diffArc("a", "move", 1), diffArc("move", "b", 1))
+	for _, tc := range []struct {
+		name       string
+		after      contract.DeclarationPetriNet
+		changes    []Change
+		compatible bool
+	}{
+		{
+			name:       "unchanged",
+			after:      before,
+			changes:    []Change{},
+			compatible: true,
+		},
+		{
+			name:  "appended",
+			after: diffModel([]string{"a", "b", "c"}, []string{"move", "reset"}, diffArc("a", "move", 1), diffArc("move", "b", 1)),
+			changes: []Change{
+				{Kind: "place", Change: "added", Label: "c", Details: []string{"offset 2"}},
+				{Kind: "transition", Change: "added", Label: "reset", Details: []string{"offset 1"}},
+			},
+			compatible: true,
+		},
+		{
+			name:  "renamed",
+			after: diffModel([]string{"start", "b"}, []string{"move"}, diffArc("start", "move", 1), diffArc("move", "b", 1)),
+			changes: []Change{
+				{Kind: "place", Change: "renamed", Label: "start", OldLabel: "a"},
+			},
+			compatible: true,
+		},
+		{
+			name:  "inserted",
+			after: diffModel([]string{"c", "a", "b"}, []string{"move"}, diffArc("a", "move", 1), diffArc("move", "b", 1)),
+			changes: []Change{
+				{Kind: "place", Change: "changed", Label: "a", Details: []string{"offset 0 -> 1"}},
+				{Kind: "place", Change: "changed", Label: "b", Details: []string{"offset 1 -> 2"}},
+				{Kind: "place", Change: "added", Label: "c", Details: []string{"offset 0"}},
+			},
+		},
+		{
+			name:  "weight",
+			after: diffModel([]string{"a", "b"}, []string{"move"}, diffArc("a", "move", 2), diffArc("move", "b", 1)),
+			changes: []Change{
+				{Kind: "transition", Change: "changed", Label: "move", Details: []string{"weights changed"}},
+				{Kind: "arc", Change: "changed", Label: "a -> move", Details: []string{"weight 1 -> 2"}},
+			},
+		},
+		{
+			name:  "guard",
+			after: diffModel([]string{"a", "b"}, []string{"move"}, diffArc("a", "move", 1), diffGuard("a", "move", 3), diffArc("move", "b", 1)),
+			changes: []Change{
+				{Kind: "transition", Change: "changed", Label: "move", Details: []string{"weights changed"}},
+				{Kind: "arc", Change: "added", Label: "a -> move (inhibitor)"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := CompareModels(before, tc.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(diff.Changes, tc.changes) {
+				t.Errorf("changes = %+v, want %+v", diff.Changes, tc.changes)
+			}
+			if diff.Compatible != tc.compatible {
+				t.Errorf("compatible = %v, want %v: %v", diff.Compatible, tc.compatible, diff.Problems)
+			}
+		})
+	}
+}
+
+func TestCompareParallelArcs(t *testing.T) {
+	before := diffModel([]string{"a"}, []string{"move"}, diffArc("a", "move", 1), diffGuard("a", "move", 2))
+	after := diffModel([]string{"a"}, []string{"move"}, diffArc("a", "move", 1), diffGuard("a", "move", 3))
+	diff, err := CompareModels(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var arcs []Change
+	for _, c := range diff.Changes {
+		if c.Kind == "arc" {
+			arcs = append(arcs, c)
+		}
+	}
+	want := []Change{{Kind: "arc", Change: "changed", Label: "a -> move (inhibitor)", Details: []string{"weight 2 -> 3"}}}
+	if !reflect.DeepEqual(arcs, want) {
+		t.Errorf("arc changes = %+v, want %+v", arcs, want)
+	}
+}
+
+func TestCompareDuplicateArcs(t *testing.T) {
+	before := diffModel([]string{"a"}, []string{"move"}, diffArc("a", "move", 1), diffArc("a", "move", 2))
+	for _, tc := range []struct {
+		name  string
+		after contract.DeclarationPetriNet
+		want  []Change
+	}{
+		{name: "unchanged", after: before},
+		{
+			name:  "second changed",
+			after: diffModel([]string{"a"}, []string{"move"}, diffArc("a", "move", 1), diffArc("a", "move", 3)),
+			want:  []Change{{Kind: "arc", Change: "changed", Label: "a -> move", Details: []string{"weight 2 -> 3"}}},
+		},
+		{
+			name:  "one removed",
+			after: diffModel([]string{"a"}, []string{"move"}, diffArc("a", "move", 1)),
+			want:  []Change{{Kind: "arc", Change: "removed", Label: "a -> move"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			changes := compareArcs(before, tc.after, map[string]string{"a": "a"}, map[string]string{"move": "move"})
+			if !reflect.DeepEqual(changes, tc.want) {
+				t.Errorf("arc changes = %+v, want %+v", changes, tc.want)
+			}
+		})
+	}
+}
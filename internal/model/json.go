@@ -0,0 +1,312 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math/big"
+	"sort"
+)
+
+type jsonModel struct {
+	ModelType   string          `json:"modelType"`
+	Version     string          `json:"version"`
+	Places      json.RawMessage `json:"places"`
+	Transitions json.RawMessage `json:"transitions"`
+	Arcs        []jsonArc       `json:"arcs"`
+}
+
+type jsonPlace struct {
+	Offset   *int  `json:"offset"`
+	Initial  int64 `json:"initial"`
+	Capacity int64 `json:"capacity"`
+	X        int64 `json:"x"`
+	Y        int64 `json:"y"`
+}
+
+type jsonTransition struct {
+	Offset *int  `json:"offset"`
+	Role   uint8 `json:"role"`
+	X      int64 `json:"x"`
+	Y      int64 `json:"y"`
+}
+
+type jsonArc struct {
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	Weight  *int64 `json:"weight"`
+	Consume *bool  `json:"consume"`
+	Produce *bool  `json:"produce"`
+	Inhibit bool   `json:"inhibit"`
+	Read    bool   `json:"read"`
+}
+
+// ModelType is the pflow model type of every contract model.
+const ModelType = "petriNet"
+
+// JsonEntry is one key of an object written by EncodeJson, in order.
+type JsonEntry struct {
+	Key   string
+	Value int64
+}
+
+// JsonField is a top level field EncodeJson writes after the model.
+type JsonField struct {
+	key     string
+	entries []JsonEntry
+	object  bool
+	value   any
+}
+
+// ObjectField is an object written one entry per line, like the places of the model.
+func ObjectField(key string, entries []JsonEntry) JsonField {
+	return JsonField{key: key, entries: entries, object: true}
+}
+
+// ValueField is any value encoding/json writes on a single line.
+func ValueField(key string, value any) JsonField {
+	return JsonField{key: key, value: value}
+}
+
+// EncodeJson writes a declaration as a pflow v0 model. Places and transitions are written in offset order
+// with their offsets, arcs in declaration order with every flag, so DecodeJson reads back the same declaration.
+// Positions are scaled to pixels for pflow. Fields follow the arcs, a snapshot adds its state this way.
+func EncodeJson(decl contract.DeclarationPetriNet, fields ...JsonField) ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("{\n")
+	fmt.Fprintf(&out, "  \"modelType\": %q,\n", ModelType)
+	out.WriteString("  \"version\": \"v0\",\n")
+
+	out.WriteString("  \"places\": {")
+	for i, p := range decl.Places {
+		label, err := json.Marshal(p.Label)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, "%s\n    %s: {\"offset\": %d, \"initial\": %d, \"capacity\": %d, \"x\": %d, \"y\": %d}",
+			separator(i), label, i, bigOrZero(p.Initial), bigOrZero(p.Capacity), toPixel(p.X, 0), toPixel(p.Y, Margin))
+	}
+	out.WriteString(closing(len(decl.Places), "}") + ",\n")
+
+	out.WriteString("  \"transitions\": {")
+	for i, t := range decl.Transitions {
+		label, err := json.Marshal(t.Label)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, "%s\n    %s: {\"offset\": %d, \"role\": %d, \"x\": %d, \"y\": %d}",
+			separator(i), label, i, t.Role, toPixel(t.X, 0), toPixel(t.Y, Margin))
+	}
+	out.WriteString(closing(len(decl.Transitions), "}") + ",\n")
+
+	out.WriteString("  \"arcs\": [")
+	for i, a := range decl.Arcs {
+		source, err := json.Marshal(a.Source)
+		if err != nil {
+			return nil, err
+		}
+		target, err := json.Marshal(a.Target)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, "%s\n    {\"source\": %s, \"target\": %s, \"weight\": %d, \"consume\": %t, \"produce\": %t, \"inhibit\": %t, \"read\": %t}",
+			separator(i), source, target, bigOrZero(a.Weight), a.Consume, a.Produce, a.Inhibit, a.Read)
+	}
+	out.WriteString(closing(len(decl.Arcs), "]"))
+
+	for _, f := range fields {
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&out, ",\n  %s: ", key)
+		if !f.object {
+			value, err := json.Marshal(f.value)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(value)
+			continue
+		}
+		out.WriteString("{")
+		for i, e := range f.entries {
+			label, err := json.Marshal(e.Key)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&out, "%s\n    %s: %d", separator(i), label, e.Value)
+		}
+		out.WriteString(closing(len(f.entries), "}"))
+	}
+	out.WriteString("\n}\n")
+	return out.Bytes(), nil
+}
+
+func separator(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return ","
+}
+
+// closing ends a collection, an empty one stays on a single line.
+func closing(n int, bracket string) string {
+	if n == 0 {
+		return bracket
+	}
+	return "\n  " + bracket
+}
+
+func toPixel(v uint8, margin int64) int64 {
+	return int64(v)*Scale + margin
+}
+
+// DecodeJson reads a pflow v0 model, as emitted by pflow.xyz or EncodeJson, into a declaration.
+// Places and transitions keep their order in the file unless every entry has an offset.
+// Pixel positions are scaled back down to the declaration grid.
+func DecodeJson(data []byte) (contract.DeclarationPetriNet, error) {
+	var decl contract.DeclarationPetriNet
+	var m jsonModel
+	if err := json.Unmarshal(data, &m); err != nil {
+		return decl, err
+	}
+	if m.Version != "" && m.Version != "v0" {
+		return decl, fmt.Errorf("unsupported model version %q", m.Version)
+	}
+
+	placeLabels, err := orderedKeys(m.Places)
+	if err != nil {
+		return decl, fmt.Errorf("places: %w", err)
+	}
+	places := map[string]*jsonPlace{}
+	if err := unmarshalObject(m.Places, &places); err != nil {
+		return decl, fmt.Errorf("places: %w", err)
+	}
+	for label, p := range places {
+		if p == nil {
+			places[label] = new(jsonPlace)
+		}
+	}
+	sortByOffset(placeLabels, func(label string) *int { return places[label].Offset })
+	for _, label := range placeLabels {
+		p := places[label]
+		decl.Places = append(decl.Places, contract.Declarationplace{
+			Label:    label,
+			X:        toGrid(p.X, 0),
+			Y:        toGrid(p.Y, Margin),
+			Initial:  big.NewInt(p.Initial),
+			Capacity: big.NewInt(p.Capacity),
+		})
+	}
+
+	transitionLabels, err := orderedKeys(m.Transitions)
+	if err != nil {
+		return decl, fmt.Errorf("transitions: %w", err)
+	}
+	transitions := map[string]*jsonTransition{}
+	if err := unmarshalObject(m.Transitions, &transitions); err != nil {
+		return decl, fmt.Errorf("transitions: %w", err)
+	}
+	for label, t := range transitions {
+		if t == nil {
+			transitions[label] = new(jsonTransition)
+		}
+	}
+	sortByOffset(transitionLabels, func(label string) *int { return transitions[label].Offset })
+	for _, label := range transitionLabels {
+		t := transitions[label]
+		decl.Transitions = append(decl.Transitions, contract.Declarationtransition{
+			Label: label,
+			X:     toGrid(t.X, 0),
+			Y:     toGrid(t.Y, Margin),
+			Role:  t.Role,
+		})
+	}
+
+	for _, a := range m.Arcs {
+		// pflow.xyz leaves out the weight of a single token arc, an explicit weight must be positive
+		weight := int64(1)
+		if a.Weight != nil {
+			weight = *a.Weight
+		}
+		if weight <= 0 {
+			return decl, fmt.Errorf("arc %s -> %s: weight must be > 0", a.Source, a.Target)
+		}
+		// files from pflow.xyz leave out the flags that follow from the arc direction
+		_, fromPlace := places[a.Source]
+		consume, produce := fromPlace, !fromPlace
+		if a.Consume != nil {
+			consume = *a.Consume
+		}
+		if a.Produce != nil {
+			produce = *a.Produce
+		}
+		decl.Arcs = append(decl.Arcs, contract.Declarationarc{
+			Source:  a.Source,
+			Target:  a.Target,
+			Weight:  big.NewInt(weight),
+			Consume: consume,
+			Produce: produce,
+			Inhibit: a.Inhibit,
+			Read:    a.Read || a.Inhibit && a.Consume == nil && !fromPlace,
+		})
+	}
+	return decl, nil
+}
+
+// toGrid undoes the pixel scaling applied for pflow, rounding to the nearest cell.
+func toGrid(v int64, margin int64) uint8 {
+	if v < margin {
+		return 0
+	}
+	cell := (v - margin + Scale/2) / Scale
+	if cell > 255 {
+		cell = 255
+	}
+	return uint8(cell)
+}
+
+func unmarshalObject(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// orderedKeys lists the keys of a JSON object in the order they appear.
+func orderedKeys(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('{') {
+		return nil, fmt.Errorf("expected an object")
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tok.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func sortByOffset(labels []string, offset func(string) *int) {
+	for _, label := range labels {
+		if offset(label) == nil {
+			return
+		}
+	}
+	sort.SliceStable(labels, func(i, j int) bool {
+		return *offset(labels[i]) < *offset(labels[j])
+	})
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestJsonRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/jetsam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl, err := DecodeJson(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := EncodeJson(decl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, out) {
+		t.Errorf("testdata/jetsam.json does not round-trip:\n%s", out)
+	}
+}
+
+func TestDecodeJsonWeight(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		weight string
+		want   int64
+		err    string
+	}{
+		{name: "omitted", weight: "", want: 1},
+		{name: "explicit", weight: `, "weight": 3`, want: 3},
+		{name: "zero", weight: `, "weight": 0`, err: "weight must be > 0"},
+		{name: "negative", weight: `, "weight": -1`, err: "weight must be > 0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := `{"places": {"p": {}}, "transitions": {"t": {}}, "arcs": [{"source": "p", "target": "t"` + tc.weight + `}]}`
+			decl, err := DecodeJson([]byte(data))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := decl.Arcs[0].Weight.Int64(); got != tc.want {
+				t.Errorf("got weight %d, want %d", got, tc.want)
+			}
+			if !decl.Arcs[0].Consume || decl.Arcs[0].Produce {
+				t.Errorf("a place to transition arc should consume, got %+v", decl.Arcs[0])
+			}
+		})
+	}
+}
+
+func TestEncodeJsonFields(t *testing.T) {
+	decl, err := DecodeJson([]byte(`{"places": {"p": {"initial": 1}}, "transitions": {"t": {}}, "arcs": [{"source": "p", "target": "t"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := EncodeJson(decl,
+		ObjectField("state", []JsonEntry{{Key: "p", Value: 1}}),
+		ObjectField("actions", []JsonEntry{}),
+		ValueField("block_stats", nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `  ],
+  "state": {
+    "p": 1
+  },
+  "actions": {},
+  "block_stats": null
+}
+`
+	if !strings.HasSuffix(string(out), want) {
+		t.Errorf("got\n%s\nwant suffix\n%s", out, want)
+	}
+	if _, err := DecodeJson(out); err != nil {
+		t.Errorf("fields break decoding: %v", err)
+	}
+}
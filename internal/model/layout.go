@@ -0,0 +1,338 @@
+package model
+
+import (
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math"
+	"sort"
+)
+
+// Layouts select where nodes are drawn: as declared, computed in layers (Sugiyama style)
+// or by a force-directed simulation. Auto keeps declared positions unless nodes overlap.
+const (
+	LayoutDeclared = "declared"
+	LayoutAuto     = "auto"
+	LayoutLayered  = "layered"
+	LayoutForce    = "force"
+)
+
+// Layouts lists every layout name Layout accepts.
+var Layouts = []string{LayoutDeclared, LayoutAuto, LayoutLayered, LayoutForce}
+
+// Layout returns a copy of decl with grid positions from the named layout, "" is declared.
+func Layout(decl contract.DeclarationPetriNet, name string) (contract.DeclarationPetriNet, error) {
+	switch name {
+	case "", LayoutDeclared:
+		return decl, nil
+	case LayoutAuto:
+		if !overlapping(decl) {
+			return decl, nil
+		}
+		return layoutLayered(decl), nil
+	case LayoutLayered:
+		return layoutLayered(decl), nil
+	case LayoutForce:
+		return layoutForce(decl), nil
+	default:
+		return decl, fmt.Errorf("unsupported layout: %s", name)
+	}
+}
+
+// overlapping reports nodes sharing a grid position, as in models built without positions.
+func overlapping(decl contract.DeclarationPetriNet) bool {
+	seen := map[[2]uint8]bool{}
+	for _, p := range decl.Places {
+		if seen[[2]uint8{p.X, p.Y}] {
+			return true
+		}
+		seen[[2]uint8{p.X, p.Y}] = true
+	}
+	for _, t := range decl.Transitions {
+		if seen[[2]uint8{t.X, t.Y}] {
+			return true
+		}
+		seen[[2]uint8{t.X, t.Y}] = true
+	}
+	return false
+}
+
+// layoutGraph numbers places 0..P-1 and transitions P.. and lists their edges in the direction
+// tokens flow, a read arc points from the place it reads to its transition.
+func layoutGraph(decl contract.DeclarationPetriNet) (int, [][2]int) {
+	ids := map[string]int{}
+	for i, p := range decl.Places {
+		ids[p.Label] = i
+	}
+	for i, t := range decl.Transitions {
+		ids[t.Label] = len(decl.Places) + i
+	}
+	var edges [][2]int
+	for _, a := range decl.Arcs {
+		from, ok1 := ids[a.Source]
+		to, ok2 := ids[a.Target]
+		if !ok1 || !ok2 || from == to {
+			continue
+		}
+		if a.Read {
+			from, to = to, from
+		}
+		edges = append(edges, [2]int{from, to})
+	}
+	return len(decl.Places) + len(decl.Transitions), edges
+}
+
+// withPositions copies decl and moves node i to grid position at[i].
+func withPositions(decl contract.DeclarationPetriNet, at [][2]int) contract.DeclarationPetriNet {
+	out := contract.DeclarationPetriNet{
+		Places:      append([]contract.Declarationplace(nil), decl.Places...),
+		Transitions: append([]contract.Declarationtransition(nil), decl.Transitions...),
+		Arcs:        decl.Arcs,
+	}
+	grid := func(v int) uint8 { return uint8(max(0, min(v, math.MaxUint8))) }
+	for i := range out.Places {
+		out.Places[i].X, out.Places[i].Y = grid(at[i][0]), grid(at[i][1])
+	}
+	for i := range out.Transitions {
+		j := len(out.Places) + i
+		out.Transitions[i].X, out.Transitions[i].Y = grid(at[j][0]), grid(at[j][1])
+	}
+	return out
+}
+
+// layoutLayered removes cycles, puts each node one layer right of its furthest predecessor,
+// orders layers by barycenters to reduce crossings, then centers every layer vertically.
+func layoutLayered(decl contract.DeclarationPetriNet) contract.DeclarationPetriNet {
+	n, edges := layoutGraph(decl)
+	at := make([][2]int, n)
+	if n == 0 {
+		return decl
+	}
+
+	// cycle removal: edges back to a node on the DFS stack are reversed
+	out := make([][]int, n)
+	for _, e := range edges {
+		out[e[0]] = append(out[e[0]], e[1])
+	}
+	state := make([]int, n) // 0 new, 1 on stack, 2 done
+	reversed := map[[2]int]bool{}
+	var visit func(v int)
+	visit = func(v int) {
+		state[v] = 1
+		for _, w := range out[v] {
+			switch state[w] {
+			case 0:
+				visit(w)
+			case 1:
+				reversed[[2]int{v, w}] = true
+			}
+		}
+		state[v] = 2
+	}
+	for v := 0; v < n; v++ {
+		if state[v] == 0 {
+			visit(v)
+		}
+	}
+	var dag [][2]int
+	for _, e := range edges {
+		if reversed[e] {
+			e = [2]int{e[1], e[0]}
+		}
+		dag = append(dag, e)
+	}
+
+	// longest path layering in topological order
+	indegree := make([]int, n)
+	next := make([][]int, n)
+	for _, e := range dag {
+		next[e[0]] = append(next[e[0]], e[1])
+		indegree[e[1]]++
+	}
+	layer := make([]int, n)
+	var queue []int
+	for v := 0; v < n; v++ {
+		if indegree[v] == 0 {
+			queue = append(queue, v)
+		}
+	}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for _, w := range next[v] {
+			layer[w] = max(layer[w], layer[v]+1)
+			if indegree[w]--; indegree[w] == 0 {
+				queue = append(queue, w)
+			}
+		}
+	}
+
+	// long edges get a dummy node in every layer they cross so ordering sees them
+	nodes := n
+	var links [][2]int
+	for _, e := range dag {
+		from := e[0]
+		for l := layer[e[0]] + 1; l < layer[e[1]]; l++ {
+			layer = append(layer, l)
+			links = append(links, [2]int{from, nodes})
+			from = nodes
+			nodes++
+		}
+		links = append(links, [2]int{from, e[1]})
+	}
+	depth := 0
+	for _, l := range layer {
+		depth = max(depth, l+1)
+	}
+	layers := make([][]int, depth)
+	for v := 0; v < nodes; v++ {
+		layers[layer[v]] = append(layers[layer[v]], v)
+	}
+	up := make([][]int, nodes)
+	down := make([][]int, nodes)
+	for _, e := range links {
+		down[e[0]] = append(down[e[0]], e[1])
+		up[e[1]] = append(up[e[1]], e[0])
+	}
+
+	// crossing reduction: alternate sweeps sort each layer by the mean position of its neighbours
+	order := make([]float64, nodes)
+	for _, vs := range layers {
+		for i, v := range vs {
+			order[v] = float64(i)
+		}
+	}
+	sortLayer := func(vs []int, neighbours [][]int) {
+		key := make(map[int]float64, len(vs))
+		for _, v := range vs {
+			key[v] = order[v]
+			if len(neighbours[v]) > 0 {
+				sum := 0.0
+				for _, w := range neighbours[v] {
+					sum += order[w]
+				}
+				key[v] = sum / float64(len(neighbours[v]))
+			}
+		}
+		sort.SliceStable(vs, func(i, j int) bool { return key[vs[i]] < key[vs[j]] })
+		for i, v := range vs {
+			order[v] = float64(i)
+		}
+	}
+	for sweep := 0; sweep < 8; sweep++ {
+		if sweep%2 == 0 {
+			for l := 1; l < depth; l++ {
+				sortLayer(layers[l], up)
+			}
+		} else {
+			for l := depth - 2; l >= 0; l-- {
+				sortLayer(layers[l], down)
+			}
+		}
+	}
+
+	height := 0
+	for _, vs := range layers {
+		height = max(height, len(vs))
+	}
+	for l, vs := range layers {
+		offset := (height - len(vs)) / 2
+		for i, v := range vs {
+			if v < n {
+				at[v] = [2]int{l + 1, offset + i + 1}
+			}
+		}
+	}
+	return withPositions(decl, at)
+}
+
+// layoutForce runs a Fruchterman-Reingold simulation from the layered layout, so the result
+// is deterministic, then snaps nodes to free grid cells.
+func layoutForce(decl contract.DeclarationPetriNet) contract.DeclarationPetriNet {
+	n, edges := layoutGraph(decl)
+	if n == 0 {
+		return decl
+	}
+	start := layoutLayered(decl)
+	pos := make([][2]float64, n)
+	for i, p := range start.Places {
+		pos[i] = [2]float64{float64(p.X), float64(p.Y)}
+	}
+	for i, t := range start.Transitions {
+		pos[len(start.Places)+i] = [2]float64{float64(t.X), float64(t.Y)}
+	}
+
+	const (
+		k       = 1.5 // ideal edge length in grid cells
+		gravity = 1.0
+	)
+	temperature := math.Sqrt(float64(n))
+	for iteration := 0; iteration < 300; iteration++ {
+		move := make([][2]float64, n)
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				dx, dy := pos[i][0]-pos[j][0], pos[i][1]-pos[j][1]
+				d := math.Max(math.Hypot(dx, dy), 0.01)
+				f := k * k / d
+				move[i][0], move[i][1] = move[i][0]+dx/d*f, move[i][1]+dy/d*f
+				move[j][0], move[j][1] = move[j][0]-dx/d*f, move[j][1]-dy/d*f
+			}
+		}
+		for _, e := range edges {
+			i, j := e[0], e[1]
+			dx, dy := pos[i][0]-pos[j][0], pos[i][1]-pos[j][1]
+			d := math.Max(math.Hypot(dx, dy), 0.01)
+			f := d * d / k
+			move[i][0], move[i][1] = move[i][0]-dx/d*f, move[i][1]-dy/d*f
+			move[j][0], move[j][1] = move[j][0]+dx/d*f, move[j][1]+dy/d*f
+		}
+		// gravity keeps parts of the net that share no arcs from drifting apart
+		var center [2]float64
+		for _, p := range pos {
+			center[0], center[1] = center[0]+p[0]/float64(n), center[1]+p[1]/float64(n)
+		}
+		for i, p := range pos {
+			move[i][0] -= (p[0] - center[0]) * gravity
+			move[i][1] -= (p[1] - center[1]) * gravity
+		}
+		for i := range pos {
+			d := math.Max(math.Hypot(move[i][0], move[i][1]), 0.01)
+			step := math.Min(d, temperature)
+			pos[i][0] += move[i][0] / d * step
+			pos[i][1] += move[i][1] / d * step
+		}
+		temperature = math.Max(temperature*0.98, 0.05)
+	}
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	for _, p := range pos {
+		minX, minY = math.Min(minX, p[0]), math.Min(minY, p[1])
+	}
+	taken := map[[2]int]bool{}
+	at := make([][2]int, n)
+	for i, p := range pos {
+		at[i] = freeCell(taken, int(math.Round(p[0]-minX))+1, int(math.Round(p[1]-minY))+1)
+		taken[at[i]] = true
+	}
+	return withPositions(decl, at)
+}
+
+// freeCell is the nearest untaken cell to x, y, searching rings of growing radius.
+func freeCell(taken map[[2]int]bool, x, y int) [2]int {
+	for r := 0; ; r++ {
+		for dx := -r; dx <= r; dx++ {
+			for dy := -r; dy <= r; dy++ {
+				cell := [2]int{x + dx, y + dy}
+				if max(abs(dx), abs(dy)) == r && cell[0] >= 0 && cell[1] >= 0 && !taken[cell] {
+					return cell
+				}
+			}
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	data, err := os.ReadFile("testdata/jetsam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jetsam, err := DecodeJson(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := NewBuilder().
+		Cell("a", 1, 0, Position(0, 0)).Cell("b", 0, 0, Position(0, 0)).Cell("c", 0, 0, Position(0, 0)).
+		Func("first", 0, Position(0, 0)).Func("second", 0, Position(0, 0)).
+		Arrow(1, "a", "first").Arrow(1, "first", "b").Arrow(1, "b", "second").Arrow(1, "second", "c").
+		Declaration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		layout   string
+		decl     contract.DeclarationPetriNet
+		declared bool
+		err      string
+	}{
+		{name: "default", layout: "", decl: chain, declared: true},
+		{name: "declared", layout: LayoutDeclared, decl: chain, declared: true},
+		{name: "auto keeps positions", layout: LayoutAuto, decl: jetsam, declared: true},
+		{name: "auto overlapping", layout: LayoutAuto, decl: chain},
+		{name: "layered", layout: LayoutLayered, decl: chain},
+		{name: "layered jetsam", layout: LayoutLayered, decl: jetsam},
+		{name: "force", layout: LayoutForce, decl: chain},
+		{name: "force jetsam", layout: LayoutForce, decl: jetsam},
+		{name: "unknown", layout: "circle", decl: chain, err: "unsupported layout: circle"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			before, _ := EncodeJson(tc.decl)
+			out, err := Layout(tc.decl, tc.layout)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("err = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after, _ := EncodeJson(tc.decl); string(after) != string(before) {
+				t.Error("layout changed its input")
+			}
+			if !reflect.DeepEqual(out.Arcs, tc.decl.Arcs) {
+				t.Error("layout changed the arcs")
+			}
+			if tc.declared {
+				if !reflect.DeepEqual(out, tc.decl) {
+					t.Error("declared positions were moved")
+				}
+				return
+			}
+			if overlapping(out) {
+				t.Error("nodes overlap")
+			}
+		})
+	}
+}
+
+func TestLayoutLayeredOrder(t *testing.T) {
+	chain, err := NewBuilder().
+		Cell("a", 1, 0, Position(0, 0)).Cell("b", 0, 0, Position(0, 0)).
+		Func("move", 0, Position(0, 0)).
+		Arrow(1, "a", "move").Arrow(1, "move", "b").
+		Declaration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Layout(chain, LayoutLayered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, move := out.Places[0], out.Places[1], out.Transitions[0]
+	if !(a.X < move.X && move.X < b.X) {
+		t.Errorf("a at %d, move at %d, b at %d: tokens should flow left to right", a.X, move.X, b.X)
+	}
+}
@@ -0,0 +1,298 @@
+package model
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	pnmlNamespace = "http://www.pnml.org/version-2009/grammar/pnml"
+	pnmlPtNet     = "http://www.pnml.org/version-2009/grammar/ptnet"
+	pnmlTool      = "pflow"
+)
+
+type pnmlDoc struct {
+	XMLName xml.Name  `xml:"pnml"`
+	Xmlns   string    `xml:"xmlns,attr,omitempty"`
+	Nets    []pnmlNet `xml:"net"`
+}
+
+type pnmlNet struct {
+	Id    string     `xml:"id,attr"`
+	Type  string     `xml:"type,attr"`
+	Name  *pnmlName  `xml:"name"`
+	Pages []pnmlPage `xml:"page"`
+}
+
+type pnmlPage struct {
+	Id          string           `xml:"id,attr"`
+	Places      []pnmlPlace      `xml:"place"`
+	Transitions []pnmlTransition `xml:"transition"`
+	Arcs        []pnmlArc        `xml:"arc"`
+	Pages       []pnmlPage       `xml:"page"`
+}
+
+type pnmlName struct {
+	Text string `xml:"text"`
+}
+
+type pnmlGraphics struct {
+	Position pnmlPosition `xml:"position"`
+}
+
+type pnmlPosition struct {
+	X int64 `xml:"x,attr"`
+	Y int64 `xml:"y,attr"`
+}
+
+type pnmlValue struct {
+	Text string `xml:"text"`
+}
+
+type pnmlToolSpecific struct {
+	Tool     string `xml:"tool,attr"`
+	Version  string `xml:"version,attr"`
+	Capacity *int64 `xml:"capacity,omitempty"`
+	Role     *uint8 `xml:"role,omitempty"`
+}
+
+type pnmlPlace struct {
+	Id             string             `xml:"id,attr"`
+	Name           *pnmlName          `xml:"name"`
+	Graphics       *pnmlGraphics      `xml:"graphics"`
+	InitialMarking *pnmlValue         `xml:"initialMarking"`
+	ToolSpecific   []pnmlToolSpecific `xml:"toolspecific"`
+}
+
+type pnmlTransition struct {
+	Id           string             `xml:"id,attr"`
+	Name         *pnmlName          `xml:"name"`
+	Graphics     *pnmlGraphics      `xml:"graphics"`
+	ToolSpecific []pnmlToolSpecific `xml:"toolspecific"`
+}
+
+type pnmlArcType struct {
+	Value string `xml:"value,attr"`
+}
+
+type pnmlArc struct {
+	Id          string       `xml:"id,attr"`
+	Source      string       `xml:"source,attr"`
+	Target      string       `xml:"target,attr"`
+	Inscription *pnmlValue   `xml:"inscription"`
+	Type        *pnmlArcType `xml:"type"`
+}
+
+// EncodePnml writes a declaration as an ISO/IEC 15909-2 place/transition net.
+// Guards are written with standard semantics so tools such as TINA analyse the same net the contract runs:
+// an inhibitor guard of weight w blocks above w tokens, so it becomes an inhibitor arc of weight w+1,
+// and an inhibit-until guard becomes a test arc from the place. Capacity and role are pflow tool data.
+func EncodePnml(decl contract.DeclarationPetriNet, name string) ([]byte, error) {
+	placeIds := map[string]string{}
+	transitionIds := map[string]string{}
+	page := pnmlPage{Id: "page0"}
+
+	for i, p := range decl.Places {
+		id := "p" + strconv.Itoa(i)
+		placeIds[p.Label] = id
+		capacity := bigOrZero(p.Capacity).Int64()
+		page.Places = append(page.Places, pnmlPlace{
+			Id:             id,
+			Name:           &pnmlName{Text: p.Label},
+			Graphics:       &pnmlGraphics{Position: pnmlPosition{X: toPixel(p.X, 0), Y: toPixel(p.Y, Margin)}},
+			InitialMarking: &pnmlValue{Text: bigOrZero(p.Initial).String()},
+			ToolSpecific:   []pnmlToolSpecific{{Tool: pnmlTool, Version: "v0", Capacity: &capacity}},
+		})
+	}
+	for i, t := range decl.Transitions {
+		id := "t" + strconv.Itoa(i)
+		transitionIds[t.Label] = id
+		role := t.Role
+		page.Transitions = append(page.Transitions, pnmlTransition{
+			Id:           id,
+			Name:         &pnmlName{Text: t.Label},
+			Graphics:     &pnmlGraphics{Position: pnmlPosition{X: toPixel(t.X, 0), Y: toPixel(t.Y, Margin)}},
+			ToolSpecific: []pnmlToolSpecific{{Tool: pnmlTool, Version: "v0", Role: &role}},
+		})
+	}
+	for i, a := range decl.Arcs {
+		weight := bigOrZero(a.Weight).Int64()
+		source, target := placeIds[a.Source], transitionIds[a.Target]
+		if source == "" {
+			source, target = transitionIds[a.Source], placeIds[a.Target]
+		}
+		if source == "" || target == "" {
+			return nil, fmt.Errorf("arc %s -> %s: unknown node", a.Source, a.Target)
+		}
+		arc := pnmlArc{Id: "a" + strconv.Itoa(i), Source: source, Target: target}
+		switch {
+		case a.Inhibit && a.Consume:
+			weight++
+			arc.Type = &pnmlArcType{Value: "inhibitor"}
+		case a.Inhibit:
+			arc.Source, arc.Target = target, source
+			arc.Type = &pnmlArcType{Value: "test"}
+		}
+		arc.Inscription = &pnmlValue{Text: strconv.FormatInt(weight, 10)}
+		page.Arcs = append(page.Arcs, arc)
+	}
+
+	doc := pnmlDoc{
+		Xmlns: pnmlNamespace,
+		Nets: []pnmlNet{{
+			Id:    netId(name),
+			Type:  pnmlPtNet,
+			Name:  &pnmlName{Text: name},
+			Pages: []pnmlPage{page},
+		}},
+	}
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	enc := xml.NewEncoder(&out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	out.WriteString("\n")
+	return out.Bytes(), nil
+}
+
+// DecodePnml reads the first net of a PNML document into a declaration, nested pages are flattened.
+// It reverses the guard mapping of EncodePnml, so exported nets import unchanged.
+func DecodePnml(data []byte) (contract.DeclarationPetriNet, error) {
+	var decl contract.DeclarationPetriNet
+	var doc pnmlDoc
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return decl, err
+	}
+	if len(doc.Nets) == 0 {
+		return decl, fmt.Errorf("pnml: no net")
+	}
+	var page pnmlPage
+	flattenPages(&page, doc.Nets[0].Pages)
+
+	labels := map[string]string{}
+	isPlace := map[string]bool{}
+	for _, p := range page.Places {
+		label := nameOr(p.Name, p.Id)
+		labels[p.Id] = label
+		isPlace[p.Id] = true
+		initial, err := parseValue(p.InitialMarking)
+		if err != nil {
+			return decl, fmt.Errorf("place %s: initial marking: %w", label, err)
+		}
+		place := contract.Declarationplace{
+			Label:    label,
+			X:        toGrid(position(p.Graphics).X, 0),
+			Y:        toGrid(position(p.Graphics).Y, Margin),
+			Initial:  big.NewInt(initial),
+			Capacity: new(big.Int),
+		}
+		for _, ts := range p.ToolSpecific {
+			if ts.Tool == pnmlTool && ts.Capacity != nil {
+				place.Capacity = big.NewInt(*ts.Capacity)
+			}
+		}
+		decl.Places = append(decl.Places, place)
+	}
+	for _, t := range page.Transitions {
+		label := nameOr(t.Name, t.Id)
+		labels[t.Id] = label
+		transition := contract.Declarationtransition{
+			Label: label,
+			X:     toGrid(position(t.Graphics).X, 0),
+			Y:     toGrid(position(t.Graphics).Y, Margin),
+		}
+		for _, ts := range t.ToolSpecific {
+			if ts.Tool == pnmlTool && ts.Role != nil {
+				transition.Role = *ts.Role
+			}
+		}
+		decl.Transitions = append(decl.Transitions, transition)
+	}
+	for _, a := range page.Arcs {
+		source, target := labels[a.Source], labels[a.Target]
+		if source == "" || target == "" {
+			return decl, fmt.Errorf("arc %s: unknown node", a.Id)
+		}
+		weight, err := parseValue(a.Inscription)
+		if err != nil {
+			return decl, fmt.Errorf("arc %s: inscription: %w", a.Id, err)
+		}
+		if a.Inscription == nil {
+			weight = 1
+		}
+		fromPlace := isPlace[a.Source]
+		arc := contract.Declarationarc{Source: source, Target: target, Consume: fromPlace, Produce: !fromPlace}
+		if a.Type != nil {
+			switch a.Type.Value {
+			case "normal", "":
+			case "inhibitor":
+				if weight < 2 {
+					return decl, fmt.Errorf("arc %s: the contract blocks above its guard weight, an inhibitor of weight %d has no equivalent", a.Id, weight)
+				}
+				weight--
+				arc.Inhibit = true
+			case "test", "read":
+				if !fromPlace {
+					return decl, fmt.Errorf("arc %s: test arcs must start at a place", a.Id)
+				}
+				arc = contract.Declarationarc{Source: target, Target: source, Produce: true, Inhibit: true, Read: true}
+			default:
+				return decl, fmt.Errorf("arc %s: unsupported type %s", a.Id, a.Type.Value)
+			}
+		}
+		arc.Weight = big.NewInt(weight)
+		decl.Arcs = append(decl.Arcs, arc)
+	}
+	return decl, nil
+}
+
+func flattenPages(into *pnmlPage, pages []pnmlPage) {
+	for _, p := range pages {
+		into.Places = append(into.Places, p.Places...)
+		into.Transitions = append(into.Transitions, p.Transitions...)
+		into.Arcs = append(into.Arcs, p.Arcs...)
+		flattenPages(into, p.Pages)
+	}
+}
+
+func nameOr(name *pnmlName, id string) string {
+	if name == nil || strings.TrimSpace(name.Text) == "" {
+		return id
+	}
+	return strings.TrimSpace(name.Text)
+}
+
+func position(g *pnmlGraphics) pnmlPosition {
+	if g == nil {
+		return pnmlPosition{}
+	}
+	return g.Position
+}
+
+func parseValue(v *pnmlValue) (int64, error) {
+	if v == nil || strings.TrimSpace(v.Text) == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(strings.TrimSpace(v.Text), 10, 64)
+}
+
+// netId makes an XML id from a net name.
+func netId(name string) string {
+	id := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+	if id == "" || id[0] >= '0' && id[0] <= '9' || id[0] == '-' {
+		id = "net_" + id
+	}
+	return id
+}
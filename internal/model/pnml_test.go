@@ -0,0 +1,49 @@
+package model
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestPnmlRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/jetsam.pnml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl, err := DecodePnml(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := EncodePnml(decl, "jetsam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, out) {
+		t.Errorf("testdata/jetsam.pnml does not round-trip:\n%s", out)
+	}
+}
+
+func TestPnmlMatchesJson(t *testing.T) {
+	data, err := os.ReadFile("testdata/jetsam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJson, err := DecodeJson(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile("testdata/jetsam.pnml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromPnml, err := DecodePnml(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := EncodeJson(fromJson)
+	b, _ := EncodeJson(fromPnml)
+	if !bytes.Equal(a, b) {
+		t.Errorf("testdata/jetsam.pnml and testdata/jetsam.json declare different models")
+	}
+}
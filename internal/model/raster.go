@@ -0,0 +1,251 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+)
+
+// Rasterize paints the same drawing as EncodeSvg into an image, in pure Go so
+// frames and previews need no SVG renderer. Text uses a fixed 7x13 bitmap font.
+// Drawings with a side longer than MaxPngWidth are drawn scaled down to fit.
+func Rasterize(decl contract.DeclarationPetriNet, opts SvgOptions) *image.RGBA {
+	width, height, shapes := svgScene(decl, opts)
+	return paintScene(width, height, shapes, rasterScale(width, height, 1))
+}
+
+// MaxPngWidth bounds both sides of a raster image. Nodes can sit 255 grid cells out,
+// so larger drawings are painted straight at a smaller scale, never at full size first.
+const MaxPngWidth = 4096
+
+// EncodePng rasterizes a declaration and scales it to width pixels, keeping its aspect ratio
+// and both sides within MaxPngWidth. A width of 0 keeps the drawing's own size.
+func EncodePng(decl contract.DeclarationPetriNet, opts SvgOptions, width int) ([]byte, error) {
+	if width < 0 || width > MaxPngWidth {
+		return nil, fmt.Errorf("png width must be between 1 and %d", MaxPngWidth)
+	}
+	sceneWidth, sceneHeight, shapes := svgScene(decl, opts)
+	scale := 1.0
+	if width != 0 {
+		scale = float64(width) / sceneWidth
+	}
+	scale = rasterScale(sceneWidth, sceneHeight, scale)
+
+	// shrinking paints at the target scale, enlarging paints at full size and resamples
+	var img image.Image = paintScene(sceneWidth, sceneHeight, shapes, math.Min(scale, 1))
+	if scale > 1 {
+		scaled := image.NewRGBA(image.Rect(0, 0, rasterSide(sceneWidth, scale), rasterSide(sceneHeight, scale)))
+		xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+		img = scaled
+	}
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// rasterScale lowers scale until both sides fit MaxPngWidth.
+func rasterScale(width, height, scale float64) float64 {
+	return math.Min(scale, math.Min(MaxPngWidth/width, MaxPngWidth/height))
+}
+
+func rasterSide(length, scale float64) int {
+	return max(1, min(MaxPngWidth, int(math.Ceil(length*scale))))
+}
+
+func paintScene(width, height float64, shapes []svgShape, scale float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, rasterSide(width, scale), rasterSide(height, scale)))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for _, s := range shapes {
+		if scale != 1 {
+			s = scaleShape(s, scale)
+		}
+		paintShape(img, s)
+	}
+	return img
+}
+
+// scaleShape scales a shape's geometry, text and markers keep their pixel size.
+func scaleShape(s svgShape, scale float64) svgShape {
+	if s.strokeWidth == 0 {
+		s.strokeWidth = 1
+	}
+	s.x, s.y, s.x2, s.y2 = s.x*scale, s.y*scale, s.x2*scale, s.y2*scale
+	s.r, s.w, s.h, s.strokeWidth = s.r*scale, s.w*scale, s.h*scale, s.strokeWidth*scale
+	children := make([]svgShape, len(s.children))
+	for i, child := range s.children {
+		children[i] = scaleShape(child, scale)
+	}
+	s.children = children
+	return s
+}
+
+func paintShape(img *image.RGBA, s svgShape) {
+	alpha := 1.0
+	if s.opacity != 0 {
+		alpha = s.opacity
+	}
+	strokeWidth := math.Max(s.strokeWidth, 1)
+	switch s.kind {
+	case "line":
+		stroke := parseColor(s.stroke)
+		length := math.Hypot(s.x2-s.x, s.y2-s.y)
+		dash := func(t float64) bool {
+			// stroke-dasharray="4,3"
+			return !s.dashed || math.Mod(t*length, 7) < 4
+		}
+		paintLine(img, s.x, s.y, s.x2, s.y2, strokeWidth, stroke, alpha, dash)
+		if length == 0 {
+			return
+		}
+		// markers are 8px long and end on the line's end
+		ux, uy := (s.x2-s.x)/length, (s.y2-s.y)/length
+		switch s.marker {
+		case "arrow":
+			bx, by := s.x2-ux*8, s.y2-uy*8
+			paintPolygon(img, [][2]float64{{s.x2, s.y2}, {bx - uy*4, by + ux*4}, {bx + uy*4, by - ux*4}}, stroke, alpha)
+		case "inhibit":
+			cx, cy := s.x2-ux*4, s.y2-uy*4
+			paintCircle(img, cx, cy, 3.2, 0.8, color.RGBA{255, 255, 255, 255}, stroke, alpha)
+		}
+	case "circle":
+		paintCircle(img, s.x, s.y, s.r, strokeWidth, parseColor(s.fill), parseColor(s.stroke), alpha)
+	case "rect":
+		fill, stroke := parseColor(s.fill), parseColor(s.stroke)
+		half := strokeWidth / 2
+		paintRegion(img, s.x-half, s.y-half, s.x+s.w+half, s.y+s.h+half, alpha, func(px, py float64) (color.RGBA, float64) {
+			inside := math.Min(math.Min(px-s.x, s.x+s.w-px), math.Min(py-s.y, s.y+s.h-py))
+			if inside < 0 {
+				return stroke, clamp01(half + 0.5 + inside)
+			}
+			return mixColor(fill, stroke, clamp01(half+0.5-inside)), 1
+		})
+	case "text":
+		paintText(img, s)
+	case "group":
+		for _, child := range s.children {
+			paintShape(img, child)
+		}
+	}
+}
+
+// paintRegion blends the color at the center of every pixel in a box, coverage 0 leaves the pixel as is.
+func paintRegion(img *image.RGBA, x0, y0, x1, y1, alpha float64, at func(px, py float64) (color.RGBA, float64)) {
+	bounds := image.Rect(int(math.Floor(x0)), int(math.Floor(y0)), int(math.Ceil(x1))+1, int(math.Ceil(y1))+1).Intersect(img.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c, coverage := at(float64(x)+0.5, float64(y)+0.5)
+			if coverage > 0 {
+				blend(img, x, y, c, coverage*alpha)
+			}
+		}
+	}
+}
+
+func paintLine(img *image.RGBA, x0, y0, x1, y1, width float64, c color.RGBA, alpha float64, visible func(t float64) bool) {
+	dx, dy := x1-x0, y1-y0
+	lengthSq := dx*dx + dy*dy
+	pad := width/2 + 1
+	paintRegion(img, math.Min(x0, x1)-pad, math.Min(y0, y1)-pad, math.Max(x0, x1)+pad, math.Max(y0, y1)+pad, alpha, func(px, py float64) (color.RGBA, float64) {
+		t := 0.0
+		if lengthSq > 0 {
+			t = clamp01(((px-x0)*dx + (py-y0)*dy) / lengthSq)
+		}
+		if !visible(t) {
+			return c, 0
+		}
+		d := math.Hypot(px-(x0+t*dx), py-(y0+t*dy))
+		return c, clamp01(width/2 + 0.5 - d)
+	})
+}
+
+func paintCircle(img *image.RGBA, cx, cy, r, strokeWidth float64, fill, stroke color.RGBA, alpha float64) {
+	half := strokeWidth / 2
+	paintRegion(img, cx-r-half-1, cy-r-half-1, cx+r+half+1, cy+r+half+1, alpha, func(px, py float64) (color.RGBA, float64) {
+		d := math.Hypot(px-cx, py-cy) - r
+		if d > 0 {
+			return stroke, clamp01(half + 0.5 - d)
+		}
+		return mixColor(fill, stroke, clamp01(half+0.5+d)), 1
+	})
+}
+
+// paintPolygon fills a convex polygon given in clockwise or counterclockwise order.
+func paintPolygon(img *image.RGBA, points [][2]float64, c color.RGBA, alpha float64) {
+	x0, y0, x1, y1 := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range points {
+		x0, y0, x1, y1 = math.Min(x0, p[0]), math.Min(y0, p[1]), math.Max(x1, p[0]), math.Max(y1, p[1])
+	}
+	paintRegion(img, x0, y0, x1, y1, alpha, func(px, py float64) (color.RGBA, float64) {
+		sign := 0.0
+		for i, a := range points {
+			b := points[(i+1)%len(points)]
+			cross := (b[0]-a[0])*(py-a[1]) - (b[1]-a[1])*(px-a[0])
+			if sign == 0 {
+				sign = cross
+			} else if cross*sign < 0 {
+				return c, 0
+			}
+		}
+		return c, 1
+	})
+}
+
+func paintText(img *image.RGBA, s svgShape) {
+	c := color.RGBA{0, 0, 0, 255}
+	if s.fill != "" {
+		c = parseColor(s.fill)
+	}
+	d := font.Drawer{Dst: img, Src: image.NewUniform(c), Face: basicfont.Face7x13}
+	x := s.x
+	if s.anchor == "middle" {
+		x -= float64(d.MeasureString(s.text).Round()) / 2
+	}
+	d.Dot = fixed.P(int(math.Round(x)), int(math.Round(s.y)))
+	d.DrawString(s.text)
+}
+
+func blend(img *image.RGBA, x, y int, c color.RGBA, a float64) {
+	a = clamp01(a)
+	i := img.PixOffset(x, y)
+	out := mixColor(color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], 255}, c, a)
+	img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = out.R, out.G, out.B, 255
+}
+
+// mixColor is a with a share of b.
+func mixColor(a, b color.RGBA, share float64) color.RGBA {
+	mix := func(x, y uint8) uint8 { return uint8(math.Round(float64(x)*(1-share) + float64(y)*share)) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+// parseColor reads the colors svgScene uses: #rgb, #rrggbb, white and black.
+func parseColor(value string) color.RGBA {
+	switch value {
+	case "", "black":
+		return color.RGBA{0, 0, 0, 255}
+	case "white":
+		return color.RGBA{255, 255, 255, 255}
+	}
+	var r, g, b uint8
+	if len(value) == 4 {
+		if _, err := fmt.Sscanf(value, "#%1x%1x%1x", &r, &g, &b); err == nil {
+			return color.RGBA{r * 17, g * 17, b * 17, 255}
+		}
+	}
+	_, _ = fmt.Sscanf(value, "#%02x%02x%02x", &r, &g, &b)
+	return color.RGBA{r, g, b, 255}
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
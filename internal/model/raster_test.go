@@ -0,0 +1,73 @@
+package model
+
+import (
+	"bytes"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"image/png"
+	"os"
+	"testing"
+)
+
+func TestEncodePngSize(t *testing.T) {
+	data, err := os.ReadFile("testdata/jetsam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jetsam, err := DecodeJson(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	far, err := NewBuilder().
+		Cell("near", 0, 0, Position(0, 0)).Cell("far", 0, 0, Position(255, 255)).
+		Declaration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jetsamWidth, jetsamHeight, _ := svgScene(jetsam, SvgOptions{})
+
+	for _, tc := range []struct {
+		name         string
+		decl         contract.DeclarationPetriNet
+		width        int
+		wantW, wantH int
+		err          bool
+	}{
+		{name: "own size", decl: jetsam, width: 0, wantW: int(jetsamWidth), wantH: int(jetsamHeight)},
+		{name: "shrunk", decl: jetsam, width: 400, wantW: 400, wantH: rasterSide(jetsamHeight, 400/jetsamWidth)},
+		{name: "enlarged", decl: jetsam, width: 4096, wantW: MaxPngWidth, wantH: rasterSide(jetsamHeight, MaxPngWidth/jetsamWidth)},
+		{name: "far node", decl: far, width: 0, wantW: 4092, wantH: MaxPngWidth},
+		{name: "far node shrunk", decl: far, width: 100, wantW: 100, wantH: 101},
+		{name: "too wide", decl: jetsam, width: MaxPngWidth + 1, err: true},
+		{name: "negative", decl: jetsam, width: -1, err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := EncodePng(tc.decl, SvgOptions{}, tc.width)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := png.Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := img.Bounds(); b.Dx() != tc.wantW || b.Dy() != tc.wantH {
+				t.Errorf("png is %dx%d, want %dx%d", b.Dx(), b.Dy(), tc.wantW, tc.wantH)
+			}
+		})
+	}
+}
+
+func TestRasterizeBounded(t *testing.T) {
+	far, err := NewBuilder().Cell("far", 0, 0, Position(255, 255)).Declaration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := Rasterize(far, SvgOptions{}).Bounds(); b.Dx() > MaxPngWidth || b.Dy() > MaxPngWidth {
+		t.Errorf("rasterized %dx%d, larger than %d", b.Dx(), b.Dy(), MaxPngWidth)
+	}
+}
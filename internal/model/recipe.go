@@ -0,0 +1,189 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A recipe file describes a model as a crafting table, one statement per line:
+//
+//	# places may be declared up front, others are created where they first appear
+//	place balloon capacity 1
+//	place oxygen initial 2
+//	make_balloon_on_string: balloon + string -> balloon_on_string
+//	explode_hydrogen: lighter ? hydrogen ->
+//	make_rope: 2 twine -> rope
+//
+// Ingredients left of -> are consumed and products right of it are produced.
+// Tools before ? are read, the action waits for them without consuming them.
+// A term may start with a count, the arc weight.
+
+var recipeLabel = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type recipeTerm struct {
+	label  string
+	weight int64
+}
+
+type recipe struct {
+	line                   int
+	action                 string
+	tools, inputs, outputs []recipeTerm
+}
+
+// DecodeRecipe compiles a recipe file into a declaration with the layered layout,
+// raw materials on the left and the actions that craft them to their right.
+func DecodeRecipe(data []byte) (contract.DeclarationPetriNet, error) {
+	type place struct{ initial, capacity int64 }
+	var placeOrder []string
+	places := map[string]*place{}
+	declared := map[string]bool{}
+	addPlace := func(label string) *place {
+		if places[label] == nil {
+			places[label] = &place{}
+			placeOrder = append(placeOrder, label)
+		}
+		return places[label]
+	}
+
+	var recipes []recipe
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		fail := func(format string, args ...any) (contract.DeclarationPetriNet, error) {
+			return contract.DeclarationPetriNet{}, fmt.Errorf("recipe:%d: %s", line, fmt.Sprintf(format, args...))
+		}
+		if text == "" {
+			continue
+		}
+
+		if fields := strings.Fields(text); fields[0] == "place" {
+			if len(fields) < 2 || !recipeLabel.MatchString(fields[1]) {
+				return fail("place needs a label")
+			}
+			if declared[fields[1]] {
+				return fail("place %s declared twice", fields[1])
+			}
+			declared[fields[1]] = true
+			p := addPlace(fields[1])
+			for i := 2; i < len(fields); i += 2 {
+				if i+1 >= len(fields) {
+					return fail("%s needs a value", fields[i])
+				}
+				value, err := strconv.ParseInt(fields[i+1], 10, 64)
+				if err != nil || value < 0 {
+					return fail("invalid %s %q", fields[i], fields[i+1])
+				}
+				switch fields[i] {
+				case "initial":
+					p.initial = value
+				case "capacity":
+					p.capacity = value
+				default:
+					return fail("unknown place attribute %s", fields[i])
+				}
+			}
+			continue
+		}
+
+		action, body, ok := strings.Cut(text, ":")
+		if !ok {
+			return fail("expected 'action: ingredients -> products' or 'place label'")
+		}
+		r := recipe{line: line, action: strings.TrimSpace(action)}
+		if !recipeLabel.MatchString(r.action) {
+			return fail("invalid action %q", r.action)
+		}
+		left, right, ok := strings.Cut(body, "->")
+		if !ok {
+			return fail("%s: missing ->", r.action)
+		}
+		if tools, inputs, ok := strings.Cut(left, "?"); ok {
+			left = inputs
+			if r.tools, ok = recipeTerms(tools); !ok || len(r.tools) == 0 {
+				return fail("%s: invalid tools %q", r.action, strings.TrimSpace(tools))
+			}
+		}
+		if r.inputs, ok = recipeTerms(left); !ok {
+			return fail("%s: invalid ingredients %q", r.action, strings.TrimSpace(left))
+		}
+		if r.outputs, ok = recipeTerms(right); !ok {
+			return fail("%s: invalid products %q", r.action, strings.TrimSpace(right))
+		}
+		for _, terms := range [][]recipeTerm{r.tools, r.inputs, r.outputs} {
+			for _, term := range terms {
+				addPlace(term.label)
+			}
+		}
+		recipes = append(recipes, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return contract.DeclarationPetriNet{}, err
+	}
+
+	b := NewBuilder()
+	for _, label := range placeOrder {
+		b.Cell(label, places[label].initial, places[label].capacity, Position(0, 0))
+	}
+	for _, r := range recipes {
+		if places[r.action] != nil {
+			return contract.DeclarationPetriNet{}, fmt.Errorf("recipe:%d: %s is both an action and an ingredient", r.line, r.action)
+		}
+		b.Func(r.action, 0, Position(0, 0))
+		for _, term := range r.tools {
+			b.Guard(term.weight, r.action, term.label)
+		}
+		for _, term := range r.inputs {
+			b.Arrow(term.weight, term.label, r.action)
+		}
+		for _, term := range r.outputs {
+			b.Arrow(term.weight, r.action, term.label)
+		}
+		if _, err := b.Declaration(); err != nil {
+			return contract.DeclarationPetriNet{}, fmt.Errorf("recipe:%d: %w", r.line, err)
+		}
+	}
+	decl, err := b.Declaration()
+	if err != nil {
+		return decl, fmt.Errorf("recipe: %w", err)
+	}
+	return layoutLayered(decl), nil
+}
+
+// recipeTerms parses "2 twine + rope", an empty list is allowed.
+func recipeTerms(s string) ([]recipeTerm, bool) {
+	var terms []recipeTerm
+	if strings.TrimSpace(s) == "" {
+		return terms, true
+	}
+	for _, part := range strings.Split(s, "+") {
+		fields := strings.Fields(part)
+		term := recipeTerm{weight: 1}
+		switch len(fields) {
+		case 1:
+			term.label = fields[0]
+		case 2:
+			weight, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil || weight <= 0 {
+				return nil, false
+			}
+			term.label, term.weight = fields[1], weight
+		default:
+			return nil, false
+		}
+		if !recipeLabel.MatchString(term.label) {
+			return nil, false
+		}
+		terms = append(terms, term)
+	}
+	return terms, true
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRecipeMatchesJson(t *testing.T) {
+	data, err := os.ReadFile("testdata/jetsam.recipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl, err := DecodeRecipe(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile("testdata/jetsam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jetsam, err := DecodeJson(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Compile(decl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Compile(jetsam)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Places) != len(want.Places) || len(got.Transitions) != len(want.Transitions) {
+		t.Fatalf("%d places and %d transitions, want %d and %d", len(got.Places), len(got.Transitions), len(want.Places), len(want.Transitions))
+	}
+	for i, p := range got.Places {
+		if p.Label != want.Places[i].Label {
+			t.Errorf("place %d is %s, want %s", i, p.Label, want.Places[i].Label)
+		}
+	}
+	for i, tr := range got.Transitions {
+		w := want.Transitions[i]
+		if tr.Label != w.Label {
+			t.Errorf("transition %d is %s, want %s", i, tr.Label, w.Label)
+			continue
+		}
+		for j := range tr.Delta {
+			if tr.Delta[j].Cmp(w.Delta[j]) != 0 || tr.Guard[j].Cmp(w.Guard[j]) != 0 {
+				t.Errorf("%s: place %s delta %s guard %s, want %s %s", tr.Label, got.Places[j].Label, tr.Delta[j], tr.Guard[j], w.Delta[j], w.Guard[j])
+			}
+		}
+	}
+}
+
+func TestDecodeRecipe(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		recipe string
+		places string
+		err    string
+	}{
+		{name: "empty", recipe: "# nothing yet\n"},
+		{name: "craft", recipe: "make_rope: 2 twine -> rope\n", places: "twine rope"},
+		{name: "tools", recipe: "place lighter initial 1\nburn: lighter ? candle -> wax\n", places: "lighter candle wax"},
+		{name: "no products", recipe: "breathe: oxygen ->\n", places: "oxygen"},
+		{name: "not a statement", recipe: "rope\n", err: "recipe:1: expected 'action: ingredients -> products' or 'place label'"},
+		{name: "missing arrow", recipe: "make_rope: twine\n", err: "recipe:1: make_rope: missing ->"},
+		{name: "invalid action", recipe: "make rope: twine -> rope\n", err: `recipe:1: invalid action "make rope"`},
+		{name: "zero count", recipe: "make_rope: 0 twine -> rope\n", err: `recipe:1: make_rope: invalid ingredients "0 twine"`},
+		{name: "empty tools", recipe: "make_rope: ? twine -> rope\n", err: `recipe:1: make_rope: invalid tools ""`},
+		{name: "place twice", recipe: "place rope\nplace rope\n", err: "recipe:2: place rope declared twice"},
+		{name: "place attribute", recipe: "place rope color 1\n", err: "recipe:1: unknown place attribute color"},
+		{name: "negative initial", recipe: "place rope initial -1\n", err: `recipe:1: invalid initial "-1"`},
+		{name: "action and ingredient", recipe: "rope: twine -> rope\n", err: "recipe:1: rope is both an action and an ingredient"},
+		{name: "action twice", recipe: "make: a -> b\nmake: b -> a\n", err: "recipe:2: func make: label declared twice"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			decl, err := DecodeRecipe([]byte(tc.recipe))
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("err = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var places []string
+			for _, p := range decl.Places {
+				places = append(places, p.Label)
+			}
+			if strings.Join(places, " ") != tc.places {
+				t.Errorf("places %v, want %s", places, tc.places)
+			}
+			if overlapping(decl) {
+				t.Error("recipe nodes overlap")
+			}
+		})
+	}
+}
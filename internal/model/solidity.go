@@ -0,0 +1,218 @@
+package model
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// SolidityStatements is the most DSL calls in one library, Jetsam's 89 arcs
+// are split evenly across two libraries to stay under the 24KB contract size limit.
+const SolidityStatements = 48
+
+//go:embed metamodel.sol.tmpl
+var solidityTemplate string
+
+var solidity = template.Must(template.New("metamodel.sol").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(solidityTemplate))
+
+// SolidityOptions name the generated contract and its roles.
+type SolidityOptions struct {
+	Contract   string   // defaults to MyStateMachine
+	Roles      []string // role names by number, missing ones are DEFAULT and ROLE<n>
+	Statements int      // DSL calls per library, defaults to SolidityStatements
+}
+
+type solidityLibrary struct {
+	Name       string
+	Statements []string
+}
+
+// EncodeSolidity writes a MyStateMachine style contract for a declaration: the shared
+// pflow DSL, the ModelEnums, libraries that build the places, transitions and arcs,
+// and a state machine that applies deltas and guards the way Jetsam.sol does.
+func EncodeSolidity(decl contract.DeclarationPetriNet, opts SolidityOptions) ([]byte, error) {
+	if opts.Contract == "" {
+		opts.Contract = "MyStateMachine"
+	}
+	if opts.Statements <= 0 {
+		opts.Statements = SolidityStatements
+	}
+	if !isSolidityIdentifier(opts.Contract) {
+		return nil, fmt.Errorf("invalid contract name: %s", opts.Contract)
+	}
+	if len(decl.Places) > 255 || len(decl.Transitions) > 256 {
+		return nil, fmt.Errorf("%d places and %d transitions do not fit uint8 offsets", len(decl.Places), len(decl.Transitions))
+	}
+
+	places := map[string]int{}
+	var properties, cells []string
+	for i, p := range decl.Places {
+		places[p.Label] = i
+		properties = append(properties, solidityIdentifier(p.Label))
+		initial, capacity := bigOrZero(p.Initial).Int64(), bigOrZero(p.Capacity).Int64()
+		if initial < 0 || initial > 255 || capacity < 0 || capacity > 255 {
+			return nil, fmt.Errorf("place %s: initial and capacity must fit uint8", p.Label)
+		}
+		cells = append(cells, fmt.Sprintf("pflow.cell(%s, %d, %d, Model.Position(%d, %d));",
+			solidityString(p.Label), initial, capacity, p.X, p.Y))
+	}
+	properties = append(properties, "SIZE")
+
+	transitions := map[string]int{}
+	var actions, funcs []string
+	maxRole := 0
+	for i, t := range decl.Transitions {
+		transitions[t.Label] = i
+		actions = append(actions, solidityIdentifier(t.Label))
+		maxRole = max(maxRole, int(t.Role))
+		funcs = append(funcs, fmt.Sprintf("pflow.func(%s, uint8(Properties.SIZE), uint8(%d), uint8(%d), Model.Position(%d, %d));",
+			solidityString(t.Label), i, t.Role, t.X, t.Y))
+	}
+
+	var arcs []string
+	for _, a := range decl.Arcs {
+		weight := bigOrZero(a.Weight).Int64()
+		if weight < 1 || weight > 127 {
+			return nil, fmt.Errorf("arc %s -> %s: weight must fit int8", a.Source, a.Target)
+		}
+		var source, target string
+		if p, ok := places[a.Source]; ok {
+			t, ok := transitions[a.Target]
+			if !ok {
+				return nil, fmt.Errorf("arc %s -> %s: unknown transition", a.Source, a.Target)
+			}
+			source, target = fmt.Sprintf("pflow.place(%d)", p), fmt.Sprintf("pflow.transition(%d)", t)
+		} else {
+			t, ok := transitions[a.Source]
+			p, ok2 := places[a.Target]
+			if !ok || !ok2 {
+				return nil, fmt.Errorf("arc %s -> %s: unknown node", a.Source, a.Target)
+			}
+			source, target = fmt.Sprintf("pflow.transition(%d)", t), fmt.Sprintf("pflow.place(%d)", p)
+		}
+		call := "arrow"
+		if a.Inhibit {
+			call = "guard"
+		}
+		arcs = append(arcs, fmt.Sprintf("pflow.%s(%d, %s, %s);", call, weight, source, target))
+	}
+
+	roles := RoleNames(maxRole, opts.Roles)
+
+	// HALT is the terminal action every Jetsam style contract declares after the model's actions
+	for kind, names := range map[string][]string{"property": properties, "action": append(actions, "HALT"), "role": roles} {
+		seen := map[string]bool{}
+		for _, name := range names {
+			if !isSolidityIdentifier(name) {
+				return nil, fmt.Errorf("invalid %s name: %s", kind, name)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("duplicate %s name: %s", kind, name)
+			}
+			seen[name] = true
+		}
+	}
+
+	var out bytes.Buffer
+	err := solidity.Execute(&out, map[string]any{
+		"Contract":    opts.Contract,
+		"Roles":       roles,
+		"Properties":  properties,
+		"Actions":     actions,
+		"Places":      solidityLibraries("ModelPlaces", cells, opts.Statements),
+		"Transitions": solidityLibraries("ModelTransitions", funcs, opts.Statements),
+		"Arcs":        solidityLibraries("ModelArcs", arcs, opts.Statements),
+	})
+	return out.Bytes(), err
+}
+
+// RoleNames names every role up to maxRole, the given names first, then DEFAULT for role 0 and ROLE<n>.
+func RoleNames(maxRole int, names []string) []string {
+	roles := make([]string, max(maxRole+1, len(names)))
+	for i := range roles {
+		switch {
+		case i < len(names):
+			roles[i] = names[i]
+		case i == 0:
+			roles[i] = "DEFAULT"
+		default:
+			roles[i] = fmt.Sprintf("ROLE%d", i)
+		}
+	}
+	return roles
+}
+
+// solidityLibraries splits statements evenly across as few libraries as hold at most size each,
+// numbered only when there is more than one.
+func solidityLibraries(name string, statements []string, size int) []solidityLibrary {
+	var libraries []solidityLibrary
+	if count := (len(statements) + size - 1) / size; count > 1 {
+		size = (len(statements) + count - 1) / count
+	}
+	for start := 0; start < len(statements); start += size {
+		libraries = append(libraries, solidityLibrary{Statements: statements[start:min(start+size, len(statements))]})
+	}
+	for i := range libraries {
+		libraries[i].Name = name
+		if len(libraries) > 1 {
+			libraries[i].Name += fmt.Sprint(i + 1)
+		}
+	}
+	return libraries
+}
+
+var solidityKeywords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`abstract address after alias anonymous apply as assembly auto bool break byte bytes
+		calldata case catch constant constructor continue contract copyof days default define delete do else emit enum
+		ether event external fallback false final finney fixed for from function gwei hex hours if immutable implements
+		import in indexed inline int interface internal is let library macro mapping match memory minutes modifier
+		mutable new null of override partial payable pragma private promise public pure receive reference relocatable
+		return returns revert sealed seconds sizeof static storage string struct super supports switch szabo this throw
+		true try type typedef typeof ufixed uint unchecked using var view virtual weeks wei while years`) {
+		solidityKeywords[word] = true
+	}
+	for bits := 8; bits <= 256; bits += 8 {
+		solidityKeywords[fmt.Sprint("int", bits)] = true
+		solidityKeywords[fmt.Sprint("uint", bits)] = true
+	}
+	for size := 1; size <= 32; size++ {
+		solidityKeywords[fmt.Sprint("bytes", size)] = true
+	}
+}
+
+// solidityIdentifier turns a label into an enum member, Jetsam's "string" place became _string.
+func solidityIdentifier(label string) string {
+	id := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '$' {
+			return r
+		}
+		return '_'
+	}, label)
+	if id == "" || id[0] >= '0' && id[0] <= '9' || solidityKeywords[id] {
+		id = "_" + id
+	}
+	return id
+}
+
+func isSolidityIdentifier(name string) bool {
+	return name != "" && solidityIdentifier(name) == name
+}
+
+// solidityString quotes a label, non-ASCII labels need a unicode literal.
+func solidityString(s string) string {
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s)
+	for _, r := range s {
+		if r >= utf8.RuneSelf {
+			return `unicode"` + quoted + `"`
+		}
+	}
+	return `"` + quoted + `"`
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// solidityCode drops comments, indentation and blank lines, Jetsam.sol was reviewed by hand.
+func solidityCode(source string) []string {
+	var lines []string
+	for _, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "//") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestSolidityMatchesJetsam(t *testing.T) {
+	data, err := os.ReadFile("testdata/jetsam.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decl, err := DecodeJson(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := EncodeSolidity(decl, SolidityOptions{Roles: []string{"DEFAULT", "HALT"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jetsam, err := os.ReadFile("../../hardhat/contracts/Jetsam.sol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, want := solidityCode(string(out)), solidityCode(string(jetsam))
+	for i := 0; i < max(len(got), len(want)); i++ {
+		if i >= len(got) || i >= len(want) || got[i] != want[i] {
+			t.Fatalf("generated contract differs from Jetsam.sol at code line %d:\ngot:  %q\nwant: %q", i+1, line(got, i), line(want, i))
+		}
+	}
+}
+
+func line(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return "<end of file>"
+}
+
+func TestSolidityLibraries(t *testing.T) {
+	decl := contract.DeclarationPetriNet{
+		Transitions: []contract.Declarationtransition{{Label: "fill"}},
+	}
+	for i := 0; i < 100; i++ {
+		label := fmt.Sprintf("p%d", i)
+		decl.Places = append(decl.Places, contract.Declarationplace{Label: label, Initial: big.NewInt(0), Capacity: big.NewInt(0)})
+		decl.Arcs = append(decl.Arcs, contract.Declarationarc{Source: "fill", Target: label, Weight: big.NewInt(1)})
+	}
+	for _, tc := range []struct {
+		statements int
+		want       []int
+	}{
+		{statements: 0, want: []int{34, 34, 32}},
+		{statements: 48, want: []int{34, 34, 32}},
+		{statements: 50, want: []int{50, 50}},
+		{statements: 60, want: []int{50, 50}},
+		{statements: 100, want: []int{100}},
+	} {
+		t.Run(fmt.Sprint(tc.statements), func(t *testing.T) {
+			out, err := EncodeSolidity(decl, SolidityOptions{Statements: tc.statements})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, kind := range []string{"Places", "Arcs"} {
+				libraries := regexp.MustCompile(`(?s)library Model`+kind+`(\d*) \{.*?\n\}`).FindAllStringSubmatch(string(out), -1)
+				if len(libraries) != len(tc.want) {
+					t.Fatalf("%d Model%s libraries, want %d", len(libraries), kind, len(tc.want))
+				}
+				for i, library := range libraries {
+					if len(tc.want) > 1 && library[1] != fmt.Sprint(i+1) {
+						t.Errorf("library Model%s%s, want Model%s%d", kind, library[1], kind, i+1)
+					}
+					if n := strings.Count(library[0], "pflow."+map[string]string{"Places": "cell", "Arcs": "arrow"}[kind]+"("); n != tc.want[i] {
+						t.Errorf("Model%s%s has %d statements, want %d", kind, library[1], n, tc.want[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSolidityNames(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		label string
+		err   string
+	}{
+		{name: "keyword", label: "string"},
+		{name: "halt", label: "HALT", err: "duplicate action name: HALT"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			decl := contract.DeclarationPetriNet{Transitions: []contract.Declarationtransition{{Label: tc.label}}}
+			_, err := EncodeSolidity(decl, SolidityOptions{})
+			if tc.err == "" && err != nil || tc.err != "" && (err == nil || err.Error() != tc.err) {
+				t.Errorf("err = %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
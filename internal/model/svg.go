@@ -0,0 +1,276 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"html"
+	"math"
+)
+
+const (
+	placeRadius      = 16
+	transitionSize   = 30
+	svgLabelOffset   = 30
+	svgLegendRow     = 20
+	transitionFill   = "#ffffff"
+	svgDefaultStroke = "#000000"
+	svgEnabled       = "#2e7d32"
+	svgFull          = "#d32f2f"
+	svgFiring        = "#f57c00"
+)
+
+// RolePalette colors transitions by role, roles past its end reuse it from the start.
+var RolePalette = []string{"#62a8e5", "#e57373", "#81c784", "#ffb74d", "#ba68c8", "#4db6ac", "#f06292", "#a1887f"}
+
+// SvgOptions select what EncodeSvg draws on top of the net.
+type SvgOptions struct {
+	State      []int64  // token counts by place, nil shows the initial marking; full places are outlined in red
+	Enabled    []bool   // transitions that can fire, outlined in green
+	Inhibited  []bool   // transitions blocked by a guard, dimmed
+	RoleColors bool     // fill transitions with their role's color and add a legend
+	RoleLabels []string // legend labels by role number
+	Fired      []int64  // signals by transition, shaded from white to red relative to the busiest
+	Flow       []int64  // net tokens produced (positive) or consumed by place, shaded green or red
+	Firing     string   // label of the transition that just fired, outlined in orange
+	Caption    string   // a line of text under the net
+}
+
+type svgPoint struct{ x, y float64 }
+
+// svgShape is one element of a drawing, EncodeSvg writes it as SVG and Rasterize paints it.
+type svgShape struct {
+	kind        string // line, circle, rect, text or group
+	x, y        float64
+	x2, y2      float64 // line end
+	r, w, h     float64 // circle radius, rect size
+	fill        string
+	stroke      string
+	strokeWidth float64 // 0 is 1
+	dashed      bool
+	marker      string // arrow or inhibit at a line's end
+	opacity     float64
+	class       string
+	text        string
+	anchor      string // text-anchor, empty is start
+	label       string // data-label of a group, the node it draws
+	children    []svgShape
+}
+
+// svgScene lays out a declaration at its grid positions: places are circles with their token count,
+// transitions squares, inhibitor arcs end in a circle and read arcs are dashed.
+func svgScene(decl contract.DeclarationPetriNet, opts SvgOptions) (width, height float64, shapes []svgShape) {
+	points := map[string]svgPoint{}
+	isPlace := map[string]bool{}
+	width, height = float64(Scale), float64(Scale)
+	for _, p := range decl.Places {
+		pt := svgPoint{float64(toPixel(p.X, 0)), float64(toPixel(p.Y, Margin))}
+		points[p.Label], isPlace[p.Label] = pt, true
+		width, height = math.Max(width, pt.x+Scale), math.Max(height, pt.y+Scale)
+	}
+	maxRole := 0
+	for _, t := range decl.Transitions {
+		pt := svgPoint{float64(toPixel(t.X, 0)), float64(toPixel(t.Y, Margin))}
+		points[t.Label] = pt
+		width, height = math.Max(width, pt.x+Scale), math.Max(height, pt.y+Scale)
+		maxRole = max(maxRole, int(t.Role))
+	}
+	legend, roleNames := height, RoleNames(maxRole, opts.RoleLabels)
+	if opts.RoleColors {
+		height += float64(svgLegendRow * len(roleNames))
+	}
+	caption := height
+	if opts.Caption != "" {
+		height += svgLegendRow
+	}
+
+	var maxFired, maxFlow int64
+	for _, n := range opts.Fired {
+		maxFired = max(maxFired, n)
+	}
+	for _, n := range opts.Flow {
+		maxFlow = max(maxFlow, n, -n)
+	}
+
+	for _, a := range decl.Arcs {
+		from, to := points[a.Source], points[a.Target]
+		from = trimArc(from, to, isPlace[a.Source])
+		to = trimArc(to, from, isPlace[a.Target])
+		line := svgShape{kind: "line", x: from.x, y: from.y, x2: to.x, y2: to.y, stroke: svgDefaultStroke, marker: "arrow"}
+		switch arcStyle(a) {
+		case "inhibitor":
+			line.marker = "inhibit"
+		case "read":
+			line.marker, line.dashed = "inhibit", true
+		}
+		shapes = append(shapes, line)
+		if label := arcLabel(a); label != "" {
+			shapes = append(shapes, svgShape{kind: "text", x: (from.x + to.x) / 2, y: (from.y+to.y)/2 - 4, anchor: "middle", fill: "#555", text: label})
+		}
+	}
+
+	for i, p := range decl.Places {
+		pt := points[p.Label]
+		tokens := bigOrZero(p.Initial).Int64()
+		if opts.State != nil && i < len(opts.State) {
+			tokens = opts.State[i]
+		}
+		circle := svgShape{kind: "circle", x: pt.x, y: pt.y, r: placeRadius, fill: "white", stroke: svgDefaultStroke}
+		if opts.Flow != nil && i < len(opts.Flow) {
+			circle.fill = heatColor(svgFull, opts.Flow[i], maxFlow)
+			if opts.Flow[i] > 0 {
+				circle.fill = heatColor(svgEnabled, opts.Flow[i], maxFlow)
+			}
+		}
+		if capacity := bigOrZero(p.Capacity).Int64(); opts.State != nil && capacity > 0 && tokens >= capacity {
+			circle.stroke, circle.strokeWidth, circle.class = svgFull, 3, "full"
+		}
+		shapes = append(shapes, circle)
+		if opts.Flow != nil && i < len(opts.Flow) {
+			if opts.Flow[i] != 0 {
+				shapes = append(shapes, svgShape{kind: "text", x: pt.x, y: pt.y + 4, anchor: "middle", text: fmt.Sprintf("%+d", opts.Flow[i])})
+			}
+		} else if tokens != 0 {
+			shapes = append(shapes, svgShape{kind: "text", x: pt.x, y: pt.y + 4, anchor: "middle", text: fmt.Sprint(tokens)})
+		}
+		shapes = append(shapes, svgShape{kind: "text", x: pt.x, y: pt.y + svgLabelOffset, anchor: "middle", text: p.Label})
+	}
+
+	for i, t := range decl.Transitions {
+		pt := points[t.Label]
+		rect := svgShape{kind: "rect", x: pt.x - transitionSize/2, y: pt.y - transitionSize/2, w: transitionSize, h: transitionSize,
+			fill: transitionFill, stroke: svgDefaultStroke}
+		if opts.RoleColors {
+			rect.fill = RolePalette[int(t.Role)%len(RolePalette)]
+		}
+		if i < len(opts.Fired) {
+			rect.fill = heatColor(svgFull, opts.Fired[i], maxFired)
+		}
+		switch {
+		case opts.Firing != "" && t.Label == opts.Firing:
+			rect.stroke, rect.strokeWidth, rect.class = svgFiring, 4, "fired"
+		case i < len(opts.Enabled) && opts.Enabled[i]:
+			rect.stroke, rect.strokeWidth, rect.class = svgEnabled, 3, "enabled"
+		case i < len(opts.Inhibited) && opts.Inhibited[i]:
+			rect.opacity, rect.class = 0.35, "inhibited"
+		}
+		group := svgShape{kind: "group", class: "transition", label: t.Label, children: []svgShape{rect}}
+		if i < len(opts.Fired) {
+			group.children = append(group.children, svgShape{kind: "text", x: pt.x, y: pt.y + 4, anchor: "middle", text: fmt.Sprint(opts.Fired[i])})
+		}
+		group.children = append(group.children, svgShape{kind: "text", x: pt.x, y: pt.y + svgLabelOffset, anchor: "middle", text: t.Label})
+		shapes = append(shapes, group)
+	}
+
+	if opts.RoleColors {
+		for i, label := range roleNames {
+			y := legend + float64(svgLegendRow*i)
+			shapes = append(shapes,
+				svgShape{kind: "rect", x: 10, y: y, w: 12, h: 12, fill: RolePalette[i%len(RolePalette)], stroke: svgDefaultStroke},
+				svgShape{kind: "text", x: 28, y: y + 10, text: label})
+		}
+	}
+	if opts.Caption != "" {
+		shapes = append(shapes, svgShape{kind: "text", x: 10, y: caption + 14, text: opts.Caption})
+	}
+	return width, height, shapes
+}
+
+// EncodeSvg draws a declaration with svgScene.
+// Transitions are groups with a data-label, and enabled transitions, inhibited ones and full places
+// are marked with a class for stylesheets and scripts.
+func EncodeSvg(decl contract.DeclarationPetriNet, opts SvgOptions) []byte {
+	width, height, shapes := svgScene(decl, opts)
+	var out bytes.Buffer
+	writeSvgHeader(&out, width, height)
+	for _, s := range shapes {
+		writeSvgShape(&out, s)
+		out.WriteString("\n")
+	}
+	out.WriteString("</svg>\n")
+	return out.Bytes()
+}
+
+func writeSvgHeader(out *bytes.Buffer, width, height float64) {
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="0 0 %g %g" font-family="Helvetica, Arial, sans-serif" font-size="12">`+"\n", width, height, width, height)
+	out.WriteString(`<defs>` +
+		`<marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto"><path d="M0,0 L10,5 L0,10 z"/></marker>` +
+		`<marker id="inhibit" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto"><circle cx="5" cy="5" r="4" fill="white" stroke="black"/></marker>` +
+		`</defs>` + "\n")
+}
+
+func writeSvgShape(out *bytes.Buffer, s svgShape) {
+	attrs := ""
+	if s.strokeWidth != 0 {
+		attrs += fmt.Sprintf(` stroke-width="%g"`, s.strokeWidth)
+	}
+	if s.opacity != 0 {
+		attrs += fmt.Sprintf(` opacity="%g"`, s.opacity)
+	}
+	if s.class != "" {
+		attrs += ` class="` + s.class + `"`
+	}
+	switch s.kind {
+	case "line":
+		dash := ""
+		if s.dashed {
+			dash = ` stroke-dasharray="4,3"`
+		}
+		fmt.Fprintf(out, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"%s marker-end="url(#%s)"/>`,
+			s.x, s.y, s.x2, s.y2, s.stroke, dash, s.marker)
+	case "circle":
+		fmt.Fprintf(out, `<circle cx="%g" cy="%g" r="%g" fill="%s" stroke="%s"%s/>`, s.x, s.y, s.r, s.fill, s.stroke, attrs)
+	case "rect":
+		fmt.Fprintf(out, `<rect x="%g" y="%g" width="%g" height="%g" fill="%s" stroke="%s"%s/>`, s.x, s.y, s.w, s.h, s.fill, s.stroke, attrs)
+	case "text":
+		if s.anchor != "" {
+			attrs += ` text-anchor="` + s.anchor + `"`
+		}
+		if s.fill != "" {
+			attrs += ` fill="` + s.fill + `"`
+		}
+		// text positions are rounded like line ends, arc labels sit halfway along one
+		fmt.Fprintf(out, `<text x="%g" y="%g"%s>%s</text>`, math.Round(s.x*10)/10, math.Round(s.y*10)/10, attrs, html.EscapeString(s.text))
+	case "group":
+		out.WriteString("<g")
+		if s.class != "" {
+			fmt.Fprintf(out, ` class="%s" data-label="%s"`, s.class, html.EscapeString(s.label))
+		}
+		out.WriteString(">")
+		for _, child := range s.children {
+			writeSvgShape(out, child)
+		}
+		out.WriteString("</g>")
+	}
+}
+
+// heatColor blends white toward color by n/most, a zero count stays white.
+func heatColor(color string, n, most int64) string {
+	if n < 0 {
+		n = -n
+	}
+	if most == 0 || n == 0 {
+		return "white"
+	}
+	var r, g, b int
+	_, _ = fmt.Sscanf(color, "#%02x%02x%02x", &r, &g, &b)
+	// keep a little color for the least used nodes so they differ from unused ones
+	f := 0.15 + 0.85*float64(n)/float64(most)
+	blend := func(c int) int { return 255 - int(math.Round(float64(255-c)*f)) }
+	return fmt.Sprintf("#%02x%02x%02x", blend(r), blend(g), blend(b))
+}
+
+// trimArc moves an arc end from the center of its node to the node's edge.
+func trimArc(at, toward svgPoint, place bool) svgPoint {
+	dx, dy := toward.x-at.x, toward.y-at.y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return at
+	}
+	r := float64(placeRadius)
+	if !place {
+		// distance to the edge of the square along the arc
+		r = transitionSize / 2 / math.Max(math.Abs(dx), math.Abs(dy)) * length
+	}
+	return svgPoint{at.x + dx/length*r, at.y + dy/length*r}
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// jetsamMarking enables every third transition, inhibits every fifth one and fills hydrogen to its capacity.
+func jetsamMarking(decl contract.DeclarationPetriNet) (contract.DeclarationPetriNet, SvgOptions) {
+	decl.Places = append([]contract.Declarationplace(nil), decl.Places...)
+	decl.Places[1].Capacity = big.NewInt(1)
+	opts := SvgOptions{State: jetsamState(decl), Enabled: make([]bool, len(decl.Transitions)), Inhibited: make([]bool, len(decl.Transitions))}
+	for i := range decl.Transitions {
+		opts.Enabled[i], opts.Inhibited[i] = i%3 == 0, i%5 == 0
+	}
+	return decl, opts
+}
+
+// jetsamHeat fires transitions 0 to 3 times and has places consume or produce up to 10 tokens.
+func jetsamHeat(decl contract.DeclarationPetriNet) SvgOptions {
+	opts := SvgOptions{Fired: make([]int64, len(decl.Transitions)), Flow: make([]int64, len(decl.Places))}
+	for i := range opts.Fired {
+		opts.Fired[i] = int64(i % 4)
+	}
+	for i := range opts.Flow {
+		opts.Flow[i] = int64(i - 10)
+	}
+	return opts
+}
+
+func TestSvgGolden(t *testing.T) {
+	jetsam := readJetsam(t)
+	marked, marking := jetsamMarking(jetsam)
+	for _, tc := range []struct {
+		golden string
+		decl   contract.DeclarationPetriNet
+		opts   SvgOptions
+	}{
+		{golden: "jetsam.svg", decl: jetsam, opts: SvgOptions{}},
+		{golden: "jetsam.roles.svg", decl: jetsam, opts: SvgOptions{RoleColors: true, RoleLabels: []string{"DEFAULT", "HALT"}}},
+		{golden: "jetsam.state.svg", decl: marked, opts: marking},
+		{golden: "jetsam.heatmap.svg", decl: jetsam, opts: jetsamHeat(jetsam)},
+	} {
+		t.Run(tc.golden, func(t *testing.T) {
+			golden(t, tc.golden, EncodeSvg(tc.decl, tc.opts))
+		})
+	}
+}
+
+func TestSvgMarking(t *testing.T) {
+	out := string(EncodeSvg(jetsamMarking(readJetsam(t))))
+	// 0, 15, 30 and 45 are both enabled and inhibited, enabled wins
+	for class, want := range map[string]int{"enabled": 16, "inhibited": 6, "full": 1} {
+		if n := strings.Count(out, `class="`+class+`"`); n != want {
+			t.Errorf("%d %s nodes, want %d", n, class, want)
+		}
+	}
+}
+
+func TestHeatColor(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		n, most int64
+		want    string
+	}{
+		{name: "unused", n: 0, most: 5, want: "white"},
+		{name: "nothing used", n: 0, most: 0, want: "white"},
+		{name: "busiest", n: 5, most: 5, want: svgFull},
+		{name: "consumed", n: -5, most: 5, want: svgFull},
+		{name: "least", n: 1, most: 100, want: "#f8dede"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := heatColor(svgFull, tc.n, tc.most); got != tc.want {
+				t.Errorf("heatColor(%d, %d) = %s, want %s", tc.n, tc.most, got, tc.want)
+			}
+		})
+	}
+}
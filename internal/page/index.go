@@ -1,64 +1,87 @@
 package page
 
 import (
+	"embed"
+	"encoding/json"
 	"github.com/stackdump/on-chain-summer-2024/internal/service"
+	"html/template"
+	"io/fs"
 	"net/http"
-	"text/template"
+	"net/url"
 )
 
-const (
-	indexTpl = `<!DOCTYPE html>
-<html>
-<head>
-	<title>Jetsam</title>
-    <style>
-		body {
-			font-family: sans-serif;	
-		}
-		#snapshot {
-			margin: 20px;
-			padding: 20px;
-			border: 1px solid #ccc;
-			background-color: #f9f9f9;
-		}
-	</style>
-    <script>
-        model = {{.snapshot}};
-        function onLoad() {
-			var snapshot = document.getElementById("snapshot");
-            console.log("onLoad");
+//go:embed templates static
+var files embed.FS
 
-			function showSource() {
-				if (snapshot.style.display === "none") {
-					snapshot.style.display = "block";
-				} else {
-					snapshot.style.display = "none";
-				}
-			}
-            showSource(); // initially hide 
-			document.getElementById("viewSource").addEventListener("click", showSource);
-        }
-	</script>
-</head>
-<body onLoad=onLoad()>
-	<h1>Hello, {{.name}}</h1>
-	<div>
-		<Button id="viewSource">View Source</Button>
-		<div id="snapshot"><pre>{{.snapshot}}</pre></div>
-	</div>
-<script>
-</script>
-</body>
-</html>`
+var (
+	indexTemplate = template.Must(template.ParseFS(files, "templates/index.html"))
+	debugTemplate = template.Must(template.ParseFS(files, "templates/debug.html"))
 )
 
-var indexTemplate = template.Must(template.New("index").Parse(indexTpl))
+// StaticHandler serves the dashboard's scripts and stylesheets under /static/.
+var StaticHandler = func() http.Handler {
+	static, err := fs.Sub(files, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+}()
 
+// IndexHandler serves the dashboard for the request's contract, starting from the snapshot at ?block=.
 func IndexHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html")
+	if r.URL.Path != "/" {
+		service.WriteError(w, r, service.NotFound("no route for %s", r.URL.Path))
+		return
+	}
+	blockNumber, err := service.BlockParam(r)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	snapshot, err := service.NewSnapshot(service.RequestDeployment(r), blockNumber)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-	indexTemplate.Execute(w, map[string]any{
-		"name":     "Anon",
-		"snapshot": string(service.NewSnapshot().ToJson()),
+	// html/template escapes the snapshot for the script it is injected into
+	_ = indexTemplate.Execute(w, map[string]any{
+		"Title":    "Jetsam",
+		"Address":  snapshot.Address.Hex(),
+		"ChainID":  snapshot.ChainID,
+		"Block":    snapshot.Block.Number,
+		"Snapshot": json.RawMessage(snapshot.ToJson()),
+		"Image":    previewImage(r),
 	})
 }
+
+// DebugHandler serves the history page, which steps through every signal up to ?to=.
+func DebugHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := service.ParseBlock(r.URL.Query().Get("to")); err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	d := service.RequestDeployment(r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = debugTemplate.Execute(w, map[string]any{
+		"Title":   "Jetsam",
+		"Address": d.Address.Hex(),
+		"ChainID": d.ChainID,
+		"To":      r.URL.Query().Get("to"),
+	})
+}
+
+// previewImage is the absolute URL of the live diagram as a PNG, link previews do not render SVG.
+func previewImage(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	query := url.Values{"state": {"live"}, "color": {"role"}, "width": {"1200"}}
+	if block := r.URL.Query().Get("block"); block != "" {
+		query.Set("block", block)
+	}
+	u := url.URL{Scheme: scheme, Host: r.Host, Path: "/v0/png", RawQuery: query.Encode()}
+	return u.String()
+}
@@ -0,0 +1,129 @@
+// The dashboard starts from the snapshot rendered into the page and polls for new blocks.
+const refreshInterval = 10000;
+const maxEvents = 200;
+
+let current = snapshot;
+
+function element(tag, text, className) {
+	const e = document.createElement(tag);
+	if (text !== undefined) {
+		e.textContent = text;
+	}
+	if (className) {
+		e.className = className;
+	}
+	return e;
+}
+
+function showHeader(s) {
+	document.getElementById("block").textContent = s.block.number;
+	const lag = document.getElementById("lag");
+	if (s.block_stats) {
+		lag.textContent = s.block_stats.behind + " blocks (indexed " + s.block_stats.highest_index + " of " + s.block_stats.latest + ")";
+		lag.classList.toggle("behind", s.block_stats.behind > 0);
+	} else {
+		lag.textContent = "indexer unavailable";
+	}
+}
+
+// showTokens fills the token table, next highlights the places a dry run would change.
+function showTokens(s, next) {
+	const body = document.querySelector("#tokens tbody");
+	body.replaceChildren();
+	for (const [label, place] of Object.entries(s.places).sort((a, b) => a[1].offset - b[1].offset)) {
+		const row = element("tr");
+		const tokens = s.state[label];
+		row.append(element("td", label));
+		if (next && next[place.offset] !== tokens) {
+			row.className = "changed";
+			row.append(element("td", tokens + " → " + next[place.offset], "number"));
+		} else {
+			row.append(element("td", tokens, "number"));
+		}
+		row.append(element("td", place.capacity > 0 ? place.capacity : "", "number"));
+		body.append(row);
+	}
+}
+
+async function showSvg(s) {
+	const response = await fetch("/v0/svg?state=live&color=role&block=" + s.block.number);
+	if (!response.ok) {
+		return;
+	}
+	const container = document.getElementById("svg");
+	container.innerHTML = await response.text();
+	for (const g of container.querySelectorAll("g.transition")) {
+		g.addEventListener("click", () => dryRun(g.dataset.label));
+	}
+}
+
+async function dryRun(action) {
+	const panel = document.getElementById("dry-run");
+	const query = new URLSearchParams({action: action, block: current.block.number});
+	const response = await fetch("/v0/simulate?" + query);
+	const result = await response.json();
+	panel.hidden = false;
+	panel.replaceChildren();
+	if (!response.ok) {
+		panel.className = "rejected";
+		panel.append(element("strong", action), ": " + result.error.message);
+		return;
+	}
+	panel.className = result.error ? "rejected" : "";
+	panel.append(element("strong", result.action + " × " + result.scalar));
+	panel.append(result.error
+		? " would be rejected: " + result.error
+		: " would succeed at block " + result.block.number + ", changed places are highlighted in the token table.");
+	showTokens(current, result.next);
+}
+
+// eventsSince is the last block the feed has read, each poll only asks for newer signals.
+let eventsSince;
+
+function roleLabel(role) {
+	const entry = Object.entries(current.roles || {}).find(([, number]) => number === role);
+	return entry ? entry[0] : "role " + role;
+}
+
+async function showEvents() {
+	const query = new URLSearchParams({limit: maxEvents});
+	if (eventsSince !== undefined) {
+		query.set("since", eventsSince);
+	}
+	const response = await fetch("/v0/events?" + query);
+	if (!response.ok) {
+		return;
+	}
+	const page = await response.json();
+	eventsSince = page.to;
+	const list = document.getElementById("events");
+	for (const event of page.events) {
+		const item = element("li");
+		item.append(element("strong", event.label || "action " + event.action), " by " + roleLabel(event.role) + " ×" + event.scalar + " at block " + event.block_number + " ");
+		item.append(element("span", event.transaction_hash.slice(0, 10), "tx"));
+		list.prepend(item);
+	}
+	while (list.children.length > maxEvents) {
+		list.lastElementChild.remove();
+	}
+}
+
+async function refresh() {
+	const response = await fetch("/v0/snapshot");
+	if (response.ok) {
+		const s = await response.json();
+		if (s.block.number !== current.block.number) {
+			current = s;
+			showHeader(s);
+			showTokens(s);
+			await showSvg(s);
+		}
+	}
+	await showEvents();
+}
+
+showHeader(current);
+showTokens(current);
+showSvg(current);
+showEvents();
+setInterval(refresh, refreshInterval);
@@ -0,0 +1,119 @@
+// The history page loads every step once and draws the selected one, #seq=N links to a step.
+let replay = null;
+let seq = 0;
+
+function element(tag, text, className) {
+	const e = document.createElement(tag);
+	if (text !== undefined) {
+		e.textContent = text;
+	}
+	if (className) {
+		e.className = className;
+	}
+	return e;
+}
+
+function historyQuery(extra) {
+	return new URLSearchParams(Object.assign({to: replay.block.number}, extra));
+}
+
+function stateAt(n) {
+	return n === 0 ? replay.initial : replay.steps[n - 1].state;
+}
+
+function showStep() {
+	const details = document.getElementById("step");
+	details.replaceChildren();
+	const add = (term, value, className) => details.append(element("dt", term), element("dd", value, className));
+	add("sequence", seq + " of " + replay.steps.length);
+	if (seq === 0) {
+		add("action", "initial marking");
+	} else {
+		const step = replay.steps[seq - 1];
+		add("block", step.block_number);
+		add("action", step.label + " × " + step.scalar + " as role " + step.role);
+		add("sender", step.sender || "unknown", "tx");
+		add("transaction", step.transaction_hash + " log " + step.log_index, "tx");
+		if (step.error) {
+			add("replay error", step.error, "error");
+		}
+	}
+
+	const before = stateAt(Math.max(seq - 1, 0));
+	const state = stateAt(seq);
+	const body = document.querySelector("#tokens tbody");
+	body.replaceChildren();
+	replay.places.forEach((label, i) => {
+		const row = element("tr");
+		row.append(element("td", label));
+		if (seq > 0 && before[i] !== state[i]) {
+			row.className = "changed";
+			row.append(element("td", before[i] + " → " + state[i], "number"));
+		} else {
+			row.append(element("td", state[i], "number"));
+		}
+		body.append(row);
+	});
+
+	document.getElementById("slider").value = seq;
+	window.history.replaceState(null, "", "#seq=" + seq);
+	showSvg(seq);
+}
+
+async function showSvg(n) {
+	const response = await fetch("/v0/history/svg?" + historyQuery({seq: n}));
+	if (response.ok && n === seq) {
+		document.getElementById("svg").innerHTML = await response.text();
+	}
+}
+
+function go(n) {
+	seq = Math.max(0, Math.min(replay.steps.length, n));
+	showStep();
+}
+
+// jumpToBlock selects the last step in a block, or the last one before it.
+function jumpToBlock(block) {
+	let n = 0;
+	while (n < replay.steps.length && replay.steps[n].block_number <= block) {
+		n++;
+	}
+	go(n);
+}
+
+async function load() {
+	const response = await fetch("/v0/history?" + new URLSearchParams(historyTo ? {to: historyTo} : {}));
+	const body = await response.json();
+	if (!response.ok) {
+		document.getElementById("step").append(element("dd", body.error.message, "error"));
+		return;
+	}
+	replay = body;
+	document.getElementById("block").textContent = replay.block.number + (replay.diverged ? " (replay diverged from the contract state)" : "");
+	document.getElementById("slider").max = replay.steps.length;
+
+	document.getElementById("first").addEventListener("click", () => go(0));
+	document.getElementById("prev").addEventListener("click", () => go(seq - 1));
+	document.getElementById("next").addEventListener("click", () => go(seq + 1));
+	document.getElementById("last").addEventListener("click", () => go(replay.steps.length));
+	document.getElementById("slider").addEventListener("input", e => go(Number(e.target.value)));
+	document.getElementById("jump").addEventListener("submit", e => {
+		e.preventDefault();
+		const value = Number(document.getElementById("jump-value").value);
+		document.getElementById("jump-kind").value === "block" ? jumpToBlock(value) : go(value);
+	});
+	document.addEventListener("keydown", e => {
+		if (e.target.tagName === "INPUT" || e.target.tagName === "SELECT") {
+			return;
+		}
+		const moves = {ArrowLeft: seq - 1, ArrowRight: seq + 1, Home: 0, End: replay.steps.length};
+		if (e.key in moves) {
+			go(moves[e.key]);
+		}
+	});
+
+	const linked = /seq=(\d+)/.exec(location.hash);
+	go(linked ? Number(linked[1]) : replay.steps.length);
+}
+
+load();
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math/big"
+	"net/http"
+)
+
+// Block identifies the chain head that every read in a snapshot is pinned to.
+type Block struct {
+	Number    uint64 `json:"number"`
+	Hash      string `json:"hash"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+// GetBlock loads the header for number on a chain, or the latest block when number is nil.
+func GetBlock(chainID int64, number *big.Int) (*Block, error) {
+	client, err := contract.Dial(chainID)
+	if err != nil {
+		return nil, Upstream(err)
+	}
+	header, err := client.HeaderByNumber(context.Background(), number)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, NotFound("block %s not found on chain %d", number, chainID)
+	} else if err != nil {
+		return nil, Upstream(err)
+	}
+	return &Block{
+		Number:    header.Number.Uint64(),
+		Hash:      header.Hash().Hex(),
+		Timestamp: header.Time,
+	}, nil
+}
+
+func (b *Block) CallOpts() *bind.CallOpts {
+	return &bind.CallOpts{BlockNumber: new(big.Int).SetUint64(b.Number)}
+}
+
+// BlockParam reads the optional ?block=N query parameter, nil means latest.
+func BlockParam(r *http.Request) (*big.Int, error) {
+	return ParseBlock(r.URL.Query().Get("block"))
+}
+
+// ParseBlock reads a decimal or 0x block number, an empty value or "latest" is nil.
+func ParseBlock(value string) (*big.Int, error) {
+	if value == "" || value == "latest" {
+		return nil, nil
+	}
+	number, ok := new(big.Int).SetString(value, 0)
+	if !ok || number.Sign() < 0 {
+		return nil, InvalidInput("invalid block number: %s", value)
+	}
+	return number, nil
+}
+
+// blockCallOpts pins contract calls to the block requested by r.
+func blockCallOpts(r *http.Request) (*bind.CallOpts, error) {
+	number, err := BlockParam(r)
+	if err != nil || number == nil {
+		return nil, err
+	}
+	return &bind.CallOpts{BlockNumber: number}, nil
+}
@@ -1,19 +1,43 @@
 package service
 
+import (
+	"fmt"
+	"time"
+)
+
+// blockStatsTtl bounds how often snapshots ask the indexer how far it got, get_block_stats
+// calls the chain from Postgres and the stats are part of the snapshot's ETag.
+const blockStatsTtl = 15 * time.Second
+
 type BlockStats struct {
 	HighestIndex int `json:"highest_index"`
 	Latest       int `json:"latest"`
 	Behind       int `json:"behind"`
 }
 
-func GetBlockStats() (*BlockStats, error) {
-	row := Psql.QueryRow("SELECT * FROM get_block_stats();")
+func GetBlockStats(chainID int64) (*BlockStats, error) {
+	if Psql == nil {
+		return nil, errNoDatabase
+	}
+	row := Psql.QueryRow("SELECT * FROM get_block_stats($1);", chainID)
 
 	var stats BlockStats
 	err := row.Scan(&stats.HighestIndex, &stats.Latest, &stats.Behind)
 	if err != nil {
-		return nil, err
+		return nil, Database(err)
 	}
 
 	return &stats, nil
 }
+
+// CachedBlockStats is GetBlockStats shared by every request for blockStatsTtl.
+func CachedBlockStats(chainID int64) (*BlockStats, error) {
+	value, err := Snapshots.Get(fmt.Sprintf("%d/block_stats", chainID), blockStatsTtl, func() (any, error) {
+		return GetBlockStats(chainID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats := *value.(*BlockStats)
+	return &stats, nil
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"golang.org/x/sync/singleflight"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Cache is a bounded in-memory store where concurrent misses for the same key share one load.
+type Cache struct {
+	mu         sync.Mutex
+	entries    map[string]cacheEntry
+	order      []string
+	maxEntries int
+	group      singleflight.Group
+}
+
+type cacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+func NewCache(maxEntries int) *Cache {
+	return &Cache{
+		entries:    make(map[string]cacheEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+var (
+	// Immutable holds values that never change for a deployment, such as the declaration and model.
+	Immutable = NewCache(256)
+	// Snapshots holds block-pinned snapshots, older blocks are evicted first.
+	Snapshots = NewCache(64)
+	// latestBlockTtl bounds how long "latest" resolves to the same block.
+	latestBlockTtl = 2 * time.Second
+)
+
+// Get returns the cached value for key or calls load once for all concurrent callers.
+// A ttl of zero keeps the value until it is evicted.
+func (c *Cache) Get(key string, ttl time.Duration, load func() (any, error)) (any, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && (entry.expires.IsZero() || time.Now().Before(entry.expires)) {
+		return entry.value, nil
+	}
+
+	value, err, _ := c.group.Do(key, func() (any, error) {
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+		c.set(key, value, ttl)
+		return value, nil
+	})
+	return value, err
+}
+
+func (c *Cache) set(key string, value any, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := cacheEntry{value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = entry
+	for len(c.order) > c.maxEntries {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// Delete drops one entry, the next Get loads it again.
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		return
+	}
+	delete(c.entries, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Purge drops every entry, used when the tracked contract changes.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cacheEntry)
+	c.order = nil
+}
+
+func cacheKey(d contract.Deployment, parts ...any) string {
+	key := d.String()
+	for _, p := range parts {
+		key += fmt.Sprintf("/%v", p)
+	}
+	return key
+}
+
+// ResolveBlock returns the block a read of d at number is pinned to, nil means latest.
+func ResolveBlock(d contract.Deployment, number *big.Int) (*Block, error) {
+	return SourceOf(d).Block(number)
+}
+
+// resolveChainBlock returns the header for number, the latest block is shared between callers for a short time.
+func resolveChainBlock(chainID int64, number *big.Int) (*Block, error) {
+	key, ttl := fmt.Sprintf("%d/block/latest", chainID), latestBlockTtl
+	if number != nil {
+		key, ttl = fmt.Sprintf("%d/block/%s", chainID, number), 0
+	}
+	value, err := Snapshots.Get(key, ttl, func() (any, error) {
+		return GetBlock(chainID, number)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*Block), nil
+}
+
+func (b *Block) LastModified() time.Time {
+	return time.Unix(int64(b.Timestamp), 0).UTC()
+}
+
+// writeCached serves data with validators so clients can revalidate with If-None-Match or If-Modified-Since.
+func writeCached(w http.ResponseWriter, r *http.Request, contentType string, etag string, modified time.Time, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if match == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.IsZero() && !modified.Truncate(time.Second).After(since) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	_, _ = w.Write(data)
+}
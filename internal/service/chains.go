@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"net/http"
+	"strconv"
+)
+
+var errChainNotFound = NotFound("chain not registered")
+
+func ListChains() ([]contract.Chain, error) {
+	if Psql == nil {
+		return nil, errNoDatabase
+	}
+	rows, err := Psql.Query(`SELECT chain_id, name, endpoints, confirmations, poll_interval_seconds FROM chains ORDER BY chain_id`)
+	if err != nil {
+		return nil, Database(err)
+	}
+	defer rows.Close()
+
+	chains := []contract.Chain{}
+	for rows.Next() {
+		var c contract.Chain
+		err := rows.Scan(&c.ID, &c.Name, pq.Array(&c.Endpoints), &c.Confirmations, &c.PollIntervalSeconds)
+		if err != nil {
+			return nil, Database(err)
+		}
+		chains = append(chains, c)
+	}
+	return chains, Database(rows.Err())
+}
+
+func RegisterChain(c contract.Chain) error {
+	if Psql == nil {
+		return errNoDatabase
+	}
+	_, err := Psql.Exec(`
+  INSERT INTO chains (chain_id, name, endpoints, confirmations, poll_interval_seconds)
+  VALUES ($1, $2, $3, $4, $5)
+  ON CONFLICT (chain_id) DO UPDATE
+  SET name = EXCLUDED.name, endpoints = EXCLUDED.endpoints,
+      confirmations = EXCLUDED.confirmations, poll_interval_seconds = EXCLUDED.poll_interval_seconds
+ `, c.ID, c.Name, pq.Array(c.Endpoints), c.Confirmations, c.PollIntervalSeconds)
+	return Database(err)
+}
+
+func RemoveChain(id int64) error {
+	if Psql == nil {
+		return errNoDatabase
+	}
+	result, err := Psql.Exec(`DELETE FROM chains WHERE chain_id = $1`, id)
+	if err != nil {
+		return Database(err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errChainNotFound
+	}
+	return nil
+}
+
+// LoadChains registers every chain stored in the database with the contract package.
+func LoadChains() error {
+	chains, err := ListChains()
+	if err != nil {
+		return err
+	}
+	for _, c := range chains {
+		contract.AddChain(c)
+	}
+	return nil
+}
+
+// AdminChainsHandler manages chains: GET lists, POST upserts and verifies eth_chainId, DELETE ?chain_id= removes one.
+func AdminChainsHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		chains, err := ListChains()
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		writeJson(w, http.StatusOK, chains)
+	case http.MethodPost:
+		var c contract.Chain
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			WriteError(w, r, InvalidInput("invalid chain: %v", err))
+			return
+		}
+		if c.ID == 0 || c.Name == "" || len(c.Endpoints) == 0 {
+			WriteError(w, r, InvalidInput("chain_id, name and endpoints are required"))
+			return
+		}
+		if c.PollIntervalSeconds <= 0 {
+			c.PollIntervalSeconds = 60
+		}
+		contract.AddChain(c)
+		if _, err := contract.Dial(c.ID); err != nil {
+			contract.RemoveChain(c.ID)
+			_ = LoadChains()
+			WriteError(w, r, &Error{Kind: KindInvalidInput, Message: "chain endpoint rejected", Err: err})
+			return
+		}
+		if err := RegisterChain(c); err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		Event("chain_registered", map[string]interface{}{"chain_id": c.ID, "name": c.Name})
+		c.Endpoints = nil
+		writeJson(w, http.StatusCreated, c)
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("chain_id"), 10, 64)
+		if err != nil {
+			WriteError(w, r, InvalidInput("chain_id is required"))
+			return
+		}
+		err = RemoveChain(id)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		contract.RemoveChain(id)
+		Event("chain_removed", map[string]interface{}{"chain_id": id})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		WriteError(w, r, &Error{Kind: KindMethodNotAllowed, Message: "method not allowed"})
+	}
+}
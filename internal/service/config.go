@@ -0,0 +1,87 @@
+package service
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stackdump/on-chain-summer-2024/internal/config"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ApplyConfig upserts the chains and contracts declared in the config into the registry,
+// entries added through the admin API are left alone.
+func ApplyConfig(cfg *config.Config) error {
+	for _, ch := range cfg.Chains {
+		err := RegisterChain(ConfigChain(ch))
+		if err != nil {
+			return err
+		}
+	}
+	for _, ct := range cfg.Contracts {
+		err := RegisterContract(Contract{
+			ChainID:         ct.ChainID,
+			Address:         common.HexToAddress(ct.Address),
+			Label:           ct.Label,
+			DeploymentBlock: ct.DeploymentBlock,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	useConfigContracts(cfg)
+	return nil
+}
+
+func ConfigChain(ch config.Chain) contract.Chain {
+	return contract.Chain{
+		ID:                  ch.ID,
+		Name:                ch.Name,
+		Endpoints:           ch.Endpoints,
+		Confirmations:       ch.Confirmations,
+		PollIntervalSeconds: int(time.Duration(ch.PollInterval) / time.Second),
+	}
+}
+
+// UseConfigChains registers the configured chains without a database, for commands that only read the chain.
+func UseConfigChains(cfg *config.Config) {
+	for _, ch := range cfg.Chains {
+		contract.AddChain(ConfigChain(ch))
+	}
+	useConfigContracts(cfg)
+}
+
+var (
+	configContractsMu sync.RWMutex
+	configContracts   = map[contract.Deployment]config.Contract{}
+)
+
+// useConfigContracts keeps the configured contracts for lookups without a database and names their roles.
+func useConfigContracts(cfg *config.Config) {
+	configContractsMu.Lock()
+	defer configContractsMu.Unlock()
+	for _, ct := range cfg.Contracts {
+		d := contract.Deployment{ChainID: ct.ChainID, Address: common.HexToAddress(ct.Address)}
+		configContracts[d] = ct
+		if len(ct.Roles) > 0 {
+			SetRoleLabels(d, ct.Roles)
+		}
+	}
+}
+
+func configContract(d contract.Deployment) (config.Contract, bool) {
+	configContractsMu.RLock()
+	defer configContractsMu.RUnlock()
+	ct, ok := configContracts[d]
+	return ct, ok
+}
+
+// AdminConfigHandler serves the effective config, callers pass a redacted copy.
+func AdminConfigHandler(redacted *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(w, r) {
+			return
+		}
+		writeJson(w, http.StatusOK, redacted)
+	}
+}
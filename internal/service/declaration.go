@@ -1,25 +1,32 @@
 package service
 
 import (
+	"bytes"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/pflow-dev/pflow-xyz/protocol/image"
 	"github.com/pflow-dev/pflow-xyz/protocol/metamodel"
 	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"github.com/stackdump/on-chain-summer-2024/internal/model"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"net/http"
 )
 
-func GetModel() (contract.ModelPetriNet, error) {
-	contract.Connect()
-	call, _ := contract.NewMetamodelCaller(contract.Address, contract.Backend())
-	return call.Model(nil)
+// GetModel is immutable for a deployment, so it is fetched once and cached by address.
+func GetModel(d contract.Deployment, opts *bind.CallOpts) (contract.ModelPetriNet, error) {
+	value, err := Immutable.Get(cacheKey(d, "model"), 0, func() (any, error) {
+		return SourceOf(d).Model(opts)
+	})
+	if err != nil {
+		return contract.ModelPetriNet{}, err
+	}
+	return value.(contract.ModelPetriNet), nil
 }
 
 func ToMetaModel(net contract.DeclarationPetriNet) metamodel.MetaModel {
-	const ScaleX = 80
-	const ScaleY = 80
-	const Margin = 22
-
 	mm := metamodel.New()
 	pnet := mm.Net()
 
@@ -28,23 +35,24 @@ func ToMetaModel(net contract.DeclarationPetriNet) metamodel.MetaModel {
 			Label:    p.Label,
 			Offset:   int64(offset),
 			Initial:  p.Initial.Int64(),
-			Capacity: p.Initial.Int64(),
+			Capacity: p.Capacity.Int64(),
 			Position: metamodel.Position{
-				X: int64(p.X) * ScaleX,
-				Y: int64(p.Y)*ScaleY + Margin,
+				X: int64(p.X) * model.Scale,
+				Y: int64(p.Y)*model.Scale + model.Margin,
 			},
 		}
 	}
-	for _, t := range net.Transitions {
+	for offset, t := range net.Transitions {
 		tt := &metamodel.Transition{
-			Label: t.Label,
+			Label:  t.Label,
+			Offset: int64(offset),
 			Position: metamodel.Position{
-				X: int64(t.X) * ScaleX,
-				Y: int64(t.Y)*ScaleY + Margin,
+				X: int64(t.X) * model.Scale,
+				Y: int64(t.Y)*model.Scale + model.Margin,
 			},
+			// pflow labels roles, the contract numbers them
+			Role:  &metamodel.Role{Label: strconv.Itoa(int(t.Role))},
 			Delta: make(metamodel.Vector, len(pnet.Places)),
-			// FIXME support Role
-
 		}
 		pnet.Transitions[t.Label] = tt
 	}
@@ -63,75 +71,243 @@ func ToMetaModel(net contract.DeclarationPetriNet) metamodel.MetaModel {
 	return mm
 }
 
-func ToModelJson(mm metamodel.MetaModel) ([]byte, error) {
-	model := mm.Net()
-	toStr := func(int642 int64) string {
-		return strconv.Itoa(int(int642))
-	}
-	var out string
-	out += "{\n"
-	out += `  "modelType": "` + model.ModelType + `",` + "\n"
-	out += `  "version": "v0",` + "\n"
-	// -- places --
-	out += `  "places": {` + "\n"
-	for label, p := range model.Places {
-		placeJson := `{"initial": ` + toStr(p.Initial) + `, "capacity": ` + toStr(p.Capacity) + `, "x": ` + toStr(p.Position.X) + `, "y": ` + toStr(p.Position.Y) + `}`
-		out += `    "` + label + `": ` + string(placeJson) + ",\n"
-	}
-	out = out[:len(out)-2] + "\n  },\n"
-	// -- transitions --
-	out += `  "transitions": {` + "\n"
-	for label, t := range model.Transitions {
-		transitionJson := `{ "x": ` + toStr(t.Position.X) + `, "y": ` + toStr(t.Position.Y) + `}`
-		out += `    "` + label + `": ` + string(transitionJson) + ",\n"
-	}
-	out = out[:len(out)-2] + "\n  },\n"
-
-	// -- arcs --
-	out += `  "arcs": [` + "\n"
-	for _, arc := range model.Arcs {
-		arcJson := ""
-		if arc.Source.IsPlace() {
-			arcJson = `{"source": "` + arc.Source.GetPlace().Label + `", "target": "` + arc.Target.GetTransition().Label + `", "weight": ` + toStr(arc.Weight) + `}`
-		} else {
-			arcJson = `{"source": "` + arc.Source.GetTransition().Label + `", "target": "` + arc.Target.GetPlace().Label + `", "weight": ` + toStr(arc.Weight) + `}`
+// GetDeclaration is immutable for a deployment, so it is fetched once and cached by address.
+func GetDeclaration(d contract.Deployment, opts *bind.CallOpts) (contract.DeclarationPetriNet, error) {
+	value, err := Immutable.Get(cacheKey(d, "declaration"), 0, func() (any, error) {
+		return SourceOf(d).Declaration(opts)
+	})
+	if err != nil {
+		return contract.DeclarationPetriNet{}, err
+	}
+	return value.(contract.DeclarationPetriNet), nil
+}
+
+// GetLayout is the declaration with positions from model.Layout, computed once per layout.
+func GetLayout(d contract.Deployment, opts *bind.CallOpts, layout string) (contract.DeclarationPetriNet, error) {
+	if layout == "" || layout == model.LayoutDeclared {
+		return GetDeclaration(d, opts)
+	}
+	if !slices.Contains(model.Layouts, layout) {
+		return contract.DeclarationPetriNet{}, InvalidInput("unsupported layout: %s", layout)
+	}
+	value, err := Immutable.Get(cacheKey(d, "declaration", layout), 0, func() (any, error) {
+		decl, err := GetDeclaration(d, opts)
+		if err != nil {
+			return nil, err
+		}
+		return model.Layout(decl, layout)
+	})
+	if err != nil {
+		return contract.DeclarationPetriNet{}, err
+	}
+	return value.(contract.DeclarationPetriNet), nil
+}
+
+// layoutEtag extends a declaration etag with the layout, declared positions keep the plain etag.
+func layoutEtag(etag, layout string) string {
+	if layout == "" || layout == model.LayoutDeclared {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "/" + layout + `"`
+}
+
+func GetSvg(d contract.Deployment, opts *bind.CallOpts, layout string) ([]byte, error) {
+	value, err := Immutable.Get(cacheKey(d, "svg", layout), 0, func() (any, error) {
+		net, err := GetLayout(d, opts, layout)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		i := image.NewSvg(&buf)
+		i.Render(ToMetaModel(net))
+		return buf.Bytes(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+// declarationEtag never changes for a deployment, the declaration is immutable.
+func declarationEtag(d contract.Deployment) string {
+	return `"` + cacheKey(d, "declaration") + `"`
+}
+
+// DeclarationHandler serves the declaration as pflow v0 JSON, or with ?format= as pnml, dot or mermaid.
+// Diagrams annotate places with token counts at ?block= when ?state=live is given,
+// and ?layout= replaces the declared positions.
+func DeclarationHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := blockCallOpts(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	d := RequestDeployment(r)
+	layout := r.URL.Query().Get("layout")
+	net, err := GetLayout(d, opts, layout)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	etag := strings.TrimSuffix(declarationEtag(d), `"`) + "/" + format + `"`
+	var modified time.Time
+	var state []int64
+	switch r.URL.Query().Get("state") {
+	case "":
+	case "live":
+		s, err := liveState(r, d)
+		if err != nil {
+			WriteError(w, r, err)
+			return
 		}
-		out += `    ` + string(arcJson) + ",\n"
+		state = s.State
+		etag = strings.TrimSuffix(s.Etag(), `"`) + "/" + format + `"`
+		modified = s.Block.LastModified()
+	default:
+		WriteError(w, r, InvalidInput("unsupported state: %s", r.URL.Query().Get("state")))
+		return
 	}
-	out = out[:len(out)-2] + "\n  ]\n"
-	out += "}"
 
-	return []byte(out), nil
+	var data []byte
+	contentType := "application/json"
+	switch format {
+	case "json":
+		data, err = model.EncodeJson(net)
+	case "pnml":
+		contentType = "application/xml"
+		data, err = model.EncodePnml(net, d.Address.Hex())
+	case "dot":
+		contentType = "text/vnd.graphviz; charset=utf-8"
+		data = model.EncodeDot(net, d.Address.Hex(), state)
+	case "mermaid":
+		contentType = "text/plain; charset=utf-8"
+		data = model.EncodeMermaid(net, state)
+	default:
+		err = InvalidInput("unsupported format: %s", format)
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	writeCached(w, r, contentType, layoutEtag(etag, layout), modified, data)
 }
 
-func GetDeclaration() contract.DeclarationPetriNet {
-	contract.Connect()
-	call, _ := contract.NewMetamodelCaller(contract.Address, contract.Backend())
-	net, err := call.Declaration(nil)
+// liveState is the snapshot at the request's ?block=, the latest block by default.
+func liveState(r *http.Request, d contract.Deployment) (*Snapshot, error) {
+	number, err := BlockParam(r)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return net
+	return NewSnapshot(d, number)
 }
 
-func DeclarationHandler(w http.ResponseWriter, _ *http.Request) {
-	mm := ToMetaModel(GetDeclaration())
-	jsonData, err := ToModelJson(mm)
+// SvgHandler serves the pflow rendering of the model. With ?color=role transitions are filled by role,
+// and with ?state=live places show their tokens at ?block= and transitions that can fire are highlighted.
+// ?layout= replaces the declared positions.
+func SvgHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := blockCallOpts(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	} else {
-		w.Header().Set("Content-Type", "application/json")
-		_, _ = w.Write(jsonData)
+		WriteError(w, r, err)
+		return
+	}
+	d := RequestDeployment(r)
+	query := r.URL.Query()
+	layout := query.Get("layout")
+	if query.Get("color") == "" && query.Get("state") == "" {
+		svg, err := GetSvg(d, opts, layout)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		writeCached(w, r, "image/svg+xml", layoutEtag(declarationEtag(d), layout), time.Time{}, svg)
+		return
 	}
+
+	req, etag, modified, err := svgRequest(r, d, "svg")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	svg, err := RenderSvg(d, opts, req)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	writeCached(w, r, "image/svg+xml", etag, modified, svg)
 }
 
-func SvgHandler(w http.ResponseWriter, _ *http.Request) {
-	contract.Connect()
-	call, _ := contract.NewMetamodelCaller(contract.Address, contract.Backend())
-	net, _ := call.Declaration(nil)
-	m := ToMetaModel(net)
+// svgRequest reads ?color=, ?state= and ?layout= and the etag of the drawing they select.
+func svgRequest(r *http.Request, d contract.Deployment, kind string) (req SvgRequest, etag string, modified time.Time, err error) {
+	query := r.URL.Query()
+	req.Layout = query.Get("layout")
+	switch query.Get("color") {
+	case "":
+	case "role":
+		req.RoleColors = true
+	default:
+		return req, "", modified, InvalidInput("unsupported color: %s", query.Get("color"))
+	}
+	etag = strings.TrimSuffix(declarationEtag(d), `"`) + "/" + kind + "/" + query.Get("color")
+	switch query.Get("state") {
+	case "":
+	case "live":
+		req.Snapshot, err = liveState(r, d)
+		if err != nil {
+			return req, "", modified, err
+		}
+		etag = strings.TrimSuffix(req.Snapshot.Etag(), `"`) + "/" + kind + "/" + query.Get("color")
+		modified = req.Snapshot.Block.LastModified()
+	default:
+		return req, "", modified, InvalidInput("unsupported state: %s", query.Get("state"))
+	}
+	return req, layoutEtag(etag+`"`, req.Layout), modified, nil
+}
+
+// SvgRequest selects what RenderSvg draws.
+type SvgRequest struct {
+	RoleColors bool      // fill transitions by role
+	Snapshot   *Snapshot // draw this state, nil for the initial marking
+	Layout     string    // a model.Layouts name, empty for declared positions
+}
+
+// RenderSvg draws the model with model.EncodeSvg.
+func RenderSvg(d contract.Deployment, opts *bind.CallOpts, req SvgRequest) ([]byte, error) {
+	svgOpts, err := SvgOptions(d, opts, req)
+	if err != nil {
+		return nil, err
+	}
+	decl, err := GetLayout(d, opts, req.Layout)
+	if err != nil {
+		return nil, err
+	}
+	return model.EncodeSvg(decl, svgOpts), nil
+}
 
-	w.Header().Set("Content-Type", "image/svg+xml")
-	i := image.NewSvg(w)
-	i.Render(m)
+// SvgOptions resolves role labels and, for a snapshot, which transitions could fire next.
+func SvgOptions(d contract.Deployment, opts *bind.CallOpts, req SvgRequest) (model.SvgOptions, error) {
+	var svgOpts model.SvgOptions
+	if req.RoleColors {
+		net, err := GetModel(d, opts)
+		if err != nil {
+			return svgOpts, err
+		}
+		roles, err := GetRoles(d, net, opts)
+		if err != nil {
+			return svgOpts, err
+		}
+		svgOpts.RoleColors = true
+		for _, role := range roles {
+			svgOpts.RoleLabels = append(svgOpts.RoleLabels, role.Label)
+		}
+	}
+	if s := req.Snapshot; s != nil {
+		svgOpts.State = s.State
+		svgOpts.Enabled, svgOpts.Inhibited = Enabled(s.Model, s.State)
+	}
+	return svgOpts, nil
 }
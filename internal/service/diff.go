@@ -0,0 +1,272 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"github.com/stackdump/on-chain-summer-2024/internal/model"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DiffSide is one of the two snapshots being compared. Events are the signals that led to it:
+// those after the from block when both sides are the same contract, otherwise every signal
+// since the contract's deployment block.
+type DiffSide struct {
+	ChainID int64          `json:"chain_id"`
+	Address common.Address `json:"address"`
+	Block   *Block         `json:"block"`
+	Events  []Signal       `json:"events"`
+}
+
+// PlaceDiff is a place whose tokens differ, matched by label so contracts with different models compare.
+type PlaceDiff struct {
+	Label string `json:"label"`
+	From  int64  `json:"from"`
+	To    int64  `json:"to"`
+	Delta int64  `json:"delta"`
+}
+
+// TransitionDiff is an action that became enabled or disabled between the two snapshots.
+type TransitionDiff struct {
+	Label       string `json:"label"`
+	FromEnabled bool   `json:"from_enabled"`
+	ToEnabled   bool   `json:"to_enabled"`
+}
+
+// Diff lists what changed between two snapshots, unchanged places and transitions are omitted.
+type Diff struct {
+	From        DiffSide         `json:"from"`
+	To          DiffSide         `json:"to"`
+	Places      []PlaceDiff      `json:"places"`
+	Transitions []TransitionDiff `json:"transitions"`
+}
+
+// CompareSnapshots diffs the marking and enabled actions of two snapshots by label,
+// a label missing on one side counts as an empty place or a disabled action.
+func CompareSnapshots(from, to *Snapshot) *Diff {
+	diff := &Diff{
+		From:        DiffSide{ChainID: from.ChainID, Address: from.Address, Block: from.Block},
+		To:          DiffSide{ChainID: to.ChainID, Address: to.Address, Block: to.Block},
+		Places:      []PlaceDiff{},
+		Transitions: []TransitionDiff{},
+	}
+
+	fromTokens, toTokens := placeTokens(from), placeTokens(to)
+	for _, label := range unionLabels(placeLabels(from), placeLabels(to)) {
+		if fromTokens[label] != toTokens[label] {
+			diff.Places = append(diff.Places, PlaceDiff{
+				Label: label,
+				From:  fromTokens[label],
+				To:    toTokens[label],
+				Delta: toTokens[label] - fromTokens[label],
+			})
+		}
+	}
+
+	fromEnabled, toEnabled := enabledActions(from), enabledActions(to)
+	for _, label := range unionLabels(from.Actions, to.Actions) {
+		if fromEnabled[label] != toEnabled[label] {
+			diff.Transitions = append(diff.Transitions, TransitionDiff{
+				Label:       label,
+				FromEnabled: fromEnabled[label],
+				ToEnabled:   toEnabled[label],
+			})
+		}
+	}
+	return diff
+}
+
+func placeLabels(s *Snapshot) []string {
+	labels := make([]string, len(s.Model.Places))
+	for _, p := range s.Model.Places {
+		labels[p.Offset] = p.Label
+	}
+	return labels
+}
+
+func placeTokens(s *Snapshot) map[string]int64 {
+	tokens := make(map[string]int64, len(s.Model.Places))
+	for _, p := range s.Model.Places {
+		if int(p.Offset) < len(s.State) {
+			tokens[p.Label] = s.State[p.Offset]
+		}
+	}
+	return tokens
+}
+
+func enabledActions(s *Snapshot) map[string]bool {
+	enabled, _ := Enabled(s.Model, s.State)
+	actions := make(map[string]bool, len(enabled))
+	for i, ok := range enabled {
+		if i < len(s.Actions) {
+			actions[s.Actions[i]] = ok
+		}
+	}
+	return actions
+}
+
+// unionLabels keeps the order of a, followed by the labels only b has.
+func unionLabels(a, b []string) []string {
+	seen := make(map[string]bool, len(a))
+	labels := make([]string, 0, len(a))
+	for _, label := range append(append([]string{}, a...), b...) {
+		if !seen[label] {
+			seen[label] = true
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// diffAgainst is the contract named by ?against=, on ?against_chain_id= or the request contract's chain.
+// ok is false when the diff compares the request contract with itself.
+func diffAgainst(r *http.Request, d contract.Deployment) (other contract.Deployment, ok bool, err error) {
+	query := r.URL.Query()
+	hexAddress := query.Get("against")
+	if hexAddress == "" {
+		return d, false, nil
+	}
+	if !common.IsHexAddress(hexAddress) {
+		return d, false, InvalidInput("invalid address: %s", hexAddress)
+	}
+	other = contract.Deployment{ChainID: d.ChainID, Address: common.HexToAddress(hexAddress)}
+	if chainParam := query.Get("against_chain_id"); chainParam != "" {
+		other.ChainID, err = strconv.ParseInt(chainParam, 10, 64)
+		if err != nil {
+			return d, false, InvalidInput("invalid chain_id: %s", chainParam)
+		}
+	}
+	return other, other != d, nil
+}
+
+// deployedSignals are the signals from the contract's deployment block up to the snapshot.
+func deployedSignals(d contract.Deployment, s *Snapshot) ([]Signal, error) {
+	from, err := DeploymentBlock(d)
+	if err != nil {
+		return nil, err
+	}
+	return ReadSignals(d, s.Model, from, s.Block.Number)
+}
+
+// DiffHandler compares the contract at ?from= with itself at ?to=, by default from its deployment
+// block to the latest block. With ?against= it compares the contract at ?from= with another
+// contract at ?to=, both latest by default, for example two players' copies of a level.
+func DiffHandler(w http.ResponseWriter, r *http.Request) {
+	d := RequestDeployment(r)
+	other, cross, err := diffAgainst(r, d)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	query := r.URL.Query()
+	fromNumber, err := ParseBlock(query.Get("from"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	toNumber, err := ParseBlock(query.Get("to"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if fromNumber == nil && !cross {
+		deployed, err := DeploymentBlock(d)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		fromNumber = new(big.Int).SetUint64(deployed)
+	}
+
+	from, err := NewSnapshot(d, fromNumber)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	to, err := NewSnapshot(other, toNumber)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	diff := CompareSnapshots(from, to)
+
+	if cross {
+		diff.From.Events, err = deployedSignals(d, from)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		diff.To.Events, err = deployedSignals(other, to)
+	} else if from.Block.Number > to.Block.Number {
+		err = InvalidInput("from block %d is after to block %d", from.Block.Number, to.Block.Number)
+	} else {
+		diff.From.Events = []Signal{}
+		diff.To.Events, err = ReadSignals(d, to.Model, from.Block.Number+1, to.Block.Number)
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(diff)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	etag := strings.TrimSuffix(from.Etag(), `"`) + "/diff/" + strings.Trim(to.Etag(), `"`) + `"`
+	writeCached(w, r, "application/json", etag, to.Block.LastModified(), append(data, '\n'))
+}
+
+// maxModelSize bounds a POSTed model, declarations are small.
+const maxModelSize = 1 << 20
+
+// ModelDiffHandler compares the contract's declaration with the contract named by ?against=,
+// or with a pflow JSON model POSTed in the body, and reports whether the contract's indexed
+// history can be replayed under the other model.
+func ModelDiffHandler(w http.ResponseWriter, r *http.Request) {
+	d := RequestDeployment(r)
+	opts, err := blockCallOpts(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	before, err := GetDeclaration(d, opts)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	var decl contract.DeclarationPetriNet
+	other, _, err := diffAgainst(r, d)
+	switch {
+	case err != nil:
+	case r.Method == http.MethodPost:
+		var data []byte
+		data, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxModelSize))
+		if err == nil {
+			decl, err = model.DecodeJson(data)
+		}
+		if err != nil {
+			err = InvalidInput("invalid model: %v", err)
+		}
+	case r.URL.Query().Get("against") != "":
+		decl, err = GetDeclaration(other, nil)
+	default:
+		err = InvalidInput("compare with ?against= or POST a pflow JSON model")
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	diff, err := model.CompareModels(before, decl)
+	if err != nil {
+		WriteError(w, r, InvalidInput("%v", err))
+		return
+	}
+	writeJson(w, http.StatusOK, diff)
+}
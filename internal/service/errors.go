@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"net/http"
+)
+
+// ErrorKind classifies failures so handlers can map them to HTTP status codes.
+type ErrorKind string
+
+const (
+	KindUpstream         ErrorKind = "upstream_unavailable"
+	KindContractNotFound ErrorKind = "contract_not_found"
+	KindDatabase         ErrorKind = "database_unavailable"
+	KindInvalidInput     ErrorKind = "invalid_input"
+	KindNotFound         ErrorKind = "not_found"
+	KindForbidden        ErrorKind = "forbidden"
+	KindMethodNotAllowed ErrorKind = "method_not_allowed"
+	KindInternal         ErrorKind = "internal"
+)
+
+// Error is a failure with a kind, the wrapped error is kept for logs and errors.Is.
+type Error struct {
+	Kind    ErrorKind
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	if e.Message == "" {
+		return e.Err.Error()
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Upstream wraps an RPC failure, a call to an address without code is reported as contract not found.
+func Upstream(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if errors.Is(err, bind.ErrNoCode) {
+		return &Error{Kind: KindContractNotFound, Message: "no contract deployed at address", Err: err}
+	}
+	return &Error{Kind: KindUpstream, Message: "rpc request failed", Err: err}
+}
+
+// Database wraps a Postgres failure.
+func Database(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Kind: KindDatabase, Message: "database request failed", Err: err}
+}
+
+func InvalidInput(format string, args ...any) error {
+	return &Error{Kind: KindInvalidInput, Message: fmt.Sprintf(format, args...)}
+}
+
+func NotFound(format string, args ...any) error {
+	return &Error{Kind: KindNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+// ContractNotFound reports a contract that is not registered or has no code.
+func ContractNotFound(format string, args ...any) error {
+	return &Error{Kind: KindContractNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func Kind(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return KindDatabase
+	}
+	return KindInternal
+}
+
+func StatusCode(err error) int {
+	switch Kind(err) {
+	case KindInvalidInput:
+		return http.StatusBadRequest
+	case KindContractNotFound, KindNotFound:
+		return http.StatusNotFound
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case KindUpstream:
+		return http.StatusBadGateway
+	case KindDatabase:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+type requestIdKey struct{}
+
+// WithRequestId tags each request with an id, an incoming X-Request-Id is kept so calls can be traced across services.
+func WithRequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if id == "" {
+			buf := make([]byte, 8)
+			_, _ = rand.Read(buf)
+			id = hex.EncodeToString(buf)
+		}
+		w.Header().Set("X-Request-Id", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIdKey{}, id)))
+	})
+}
+
+func RequestId(r *http.Request) string {
+	id, _ := r.Context().Value(requestIdKey{}).(string)
+	return id
+}
+
+// WriteError logs err and responds with a JSON body: {"error": {"code", "message", "request_id"}}.
+// Internal errors are not echoed to the client.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	status := StatusCode(err)
+	kind := Kind(err)
+	message := err.Error()
+	if kind == KindInternal {
+		message = http.StatusText(status)
+	}
+	Event("http_error", map[string]interface{}{
+		"request_id": RequestId(r),
+		"path":       r.URL.Path,
+		"status":     status,
+		"code":       string(kind),
+		"error":      err.Error(),
+	})
+	writeJson(w, status, map[string]any{
+		"error": map[string]any{
+			"code":       kind,
+			"message":    message,
+			"request_id": RequestId(r),
+		},
+	})
+}
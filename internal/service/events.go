@@ -0,0 +1,71 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Events caps how many signals one events request returns.
+const (
+	defaultEventsLimit = 50
+	maxEventsLimit     = 500
+)
+
+// EventsPage is the newest signals up to To, a client polls for more with ?since=To.
+type EventsPage struct {
+	To     uint64   `json:"to"`
+	Events []Signal `json:"events"`
+}
+
+// EventsHandler serves the contract's signals after block ?since=, from its deployment block
+// by default, labelled by its model. Only the last ?limit= signals are returned, newest last.
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	d := RequestDeployment(r)
+	query := r.URL.Query()
+	limit := defaultEventsLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxEventsLimit {
+			WriteError(w, r, InvalidInput("limit must be between 1 and %d: %s", maxEventsLimit, value))
+			return
+		}
+		limit = n
+	}
+	block, err := ResolveBlock(d, nil)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	var from uint64
+	if value := query.Get("since"); value != "" {
+		since, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			WriteError(w, r, InvalidInput("invalid since block: %s", value))
+			return
+		}
+		from = since + 1
+	} else if from, err = DeploymentBlock(d); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	page := EventsPage{To: block.Number, Events: []Signal{}}
+	if from > block.Number {
+		page.To = from - 1
+	}
+	if from <= block.Number {
+		net, err := GetModel(d, block.CallOpts())
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		page.Events, err = ReadSignals(d, net, from, block.Number)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		page.Events = page.Events[max(0, len(page.Events)-limit):]
+	}
+	writeJson(w, http.StatusOK, page)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"github.com/stackdump/on-chain-summer-2024/internal/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Activity sums the signals of a block range: how often each action fired
+// and the tokens each place gained or lost through them.
+type Activity struct {
+	From    uint64  `json:"from"`
+	To      uint64  `json:"to"`
+	Signals int     `json:"signals"`
+	Fired   []int64 `json:"fired"` // by action
+	Flow    []int64 `json:"flow"`  // by place, delta*scalar summed over every signal
+}
+
+// GetActivity counts the signals between two blocks, inclusive, from the indexed transaction logs.
+func GetActivity(d contract.Deployment, net contract.ModelPetriNet, from, to uint64) (*Activity, error) {
+	signals, err := ReadSignals(d, net, from, to)
+	if err != nil {
+		return nil, err
+	}
+	a := &Activity{
+		From:    from,
+		To:      to,
+		Signals: len(signals),
+		Fired:   make([]int64, len(net.Transitions)),
+		Flow:    make([]int64, len(net.Places)),
+	}
+	for _, s := range signals {
+		if int(s.Action) >= len(net.Transitions) {
+			continue
+		}
+		a.Fired[s.Action]++
+		for i, delta := range net.Transitions[s.Action].Delta {
+			if i < len(a.Flow) {
+				a.Flow[i] += delta.Int64() * s.Scalar
+			}
+		}
+	}
+	return a, nil
+}
+
+// activityRange reads ?from= and ?to=: to defaults to the latest block and from to the
+// contract's deployment block, or the first block when it is not registered.
+func activityRange(r *http.Request, d contract.Deployment) (uint64, *Block, error) {
+	query := r.URL.Query()
+	toNumber, err := ParseBlock(query.Get("to"))
+	if err != nil {
+		return 0, nil, err
+	}
+	to, err := GetBlock(d.ChainID, toNumber)
+	if err != nil {
+		return 0, nil, err
+	}
+	fromNumber, err := ParseBlock(query.Get("from"))
+	if err != nil {
+		return 0, nil, err
+	}
+	var from uint64
+	if fromNumber != nil {
+		from = fromNumber.Uint64()
+	} else if from, err = DeploymentBlock(d); err != nil {
+		return 0, nil, err
+	}
+	if from > to.Number {
+		return 0, nil, InvalidInput("from block %d is after to block %d", from, to.Number)
+	}
+	return from, to, nil
+}
+
+// HeatmapHandler serves the model's SVG shaded by activity between ?from= and ?to=:
+// transitions by how often they fired and places by the tokens they gained or lost.
+// ?layout= replaces the declared positions.
+func HeatmapHandler(w http.ResponseWriter, r *http.Request) {
+	d := RequestDeployment(r)
+	from, to, err := activityRange(r, d)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	opts := to.CallOpts()
+	net, err := GetModel(d, opts)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	layout := r.URL.Query().Get("layout")
+	decl, err := GetLayout(d, opts, layout)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	activity, err := GetActivity(d, net, from, to.Number)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	svg := model.EncodeSvg(decl, model.SvgOptions{Fired: activity.Fired, Flow: activity.Flow})
+	etag := strings.TrimSuffix(declarationEtag(d), `"`) + "/heatmap/" + strconv.FormatUint(from, 10) + "-" + to.Hash + `"`
+	writeCached(w, r, "image/svg+xml", layoutEtag(etag, layout), to.LastModified(), svg)
+}
@@ -1,30 +1,35 @@
 package service
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
 )
 
-func HighestIndex() (int, error) {
-	row := Psql.QueryRow(`SELECT max(block_number) AS highest_index FROM block_numbers`)
+func HighestIndex(chainID int64) (int, error) {
+	if Psql == nil {
+		return 0, errNoDatabase
+	}
+	row := Psql.QueryRow(`SELECT max(block_number) AS highest_index FROM block_numbers WHERE chain_id = $1`, chainID)
 
-	var highestIndex int
+	// max() is NULL until the first block is indexed
+	var highestIndex sql.NullInt64
 	err := row.Scan(&highestIndex)
 	if err != nil {
-		return 0, err
+		return 0, Database(err)
 	}
 
-	return highestIndex, nil
+	return int(highestIndex.Int64), nil
 }
 
 func HighestIndexHandler(w http.ResponseWriter, r *http.Request) {
-	highestIndex, err := HighestIndex()
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(map[string]int{
-		"highest_index": highestIndex,
-	})
+	highestIndex, err := HighestIndex(RequestDeployment(r).ChainID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{
+		"highest_index": highestIndex,
+	})
 }
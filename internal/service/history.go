@@ -0,0 +1,121 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"github.com/stackdump/on-chain-summer-2024/internal/model"
+	"net/http"
+	"strconv"
+)
+
+// DeploymentBlock is where a contract's history starts: its registration, or without a database
+// its config entry. An unknown contract is an error, reading its logs from block 0 costs thousands of calls.
+func DeploymentBlock(d contract.Deployment) (uint64, error) {
+	if Psql == nil {
+		if ct, ok := configContract(d); ok {
+			return uint64(ct.DeploymentBlock), nil
+		}
+		return 0, ContractNotFound("deployment block of %s unknown, set deployment_block in the config", d)
+	}
+	c, err := GetContract(d)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(c.DeploymentBlock), nil
+}
+
+// GetHistory replays every signal from the deployment block up to block, with senders,
+// so each step's sequence matches the contract's. Histories are cached per block.
+func GetHistory(d contract.Deployment, block *Block) (*History, error) {
+	value, err := Snapshots.Get(cacheKey(d, "history", block.Number), 0, func() (any, error) {
+		from, err := DeploymentBlock(d)
+		if err != nil {
+			return nil, err
+		}
+		h, err := Replay(d, from, block)
+		if err != nil {
+			return nil, err
+		}
+		if err := FillSenders(d, h.Steps); err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*History), nil
+}
+
+// requestHistory is the history up to ?to=, the latest block by default.
+func requestHistory(r *http.Request) (*History, error) {
+	number, err := ParseBlock(r.URL.Query().Get("to"))
+	if err != nil {
+		return nil, err
+	}
+	d := RequestDeployment(r)
+	block, err := ResolveBlock(d, number)
+	if err != nil {
+		return nil, err
+	}
+	return GetHistory(d, block)
+}
+
+func historyEtag(h *History, suffix string) string {
+	return fmt.Sprintf(`"%d-%s-%s/history%s"`, h.ChainID, h.Address, h.Block.Hash, suffix)
+}
+
+// HistoryHandler serves every step of the contract's event history up to ?to=,
+// each with the marking after it, the fired action, its sender and transaction.
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	h, err := requestHistory(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	writeCached(w, r, "application/json", historyEtag(h, ""), h.Block.LastModified(), append(data, '\n'))
+}
+
+// HistoryStepHandler draws the marking after step ?seq= of the history up to ?to=, 0 is the
+// initial marking. The fired transition is outlined and those that could fire next are highlighted.
+// ?layout= replaces the declared positions.
+func HistoryStepHandler(w http.ResponseWriter, r *http.Request) {
+	h, err := requestHistory(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	seq, err := strconv.Atoi(r.URL.Query().Get("seq"))
+	if err != nil || seq < 0 || seq > len(h.Steps) {
+		WriteError(w, r, InvalidInput("seq must be between 0 and %d", len(h.Steps)))
+		return
+	}
+	d := RequestDeployment(r)
+	opts := h.Block.CallOpts()
+	net, err := GetModel(d, opts)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	layout := r.URL.Query().Get("layout")
+	decl, err := GetLayout(d, opts, layout)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	svgOpts := model.SvgOptions{State: h.Initial, Caption: "#0 initial marking"}
+	if seq > 0 {
+		step := h.Steps[seq-1]
+		svgOpts.State, svgOpts.Firing = step.State, step.Label
+		svgOpts.Caption = fmt.Sprintf("#%d block %d: %s x%d by %s", step.Sequence, step.BlockNumber, step.Label, step.Scalar, step.Sender)
+	}
+	svgOpts.Enabled, svgOpts.Inhibited = Enabled(net, svgOpts.State)
+	etag := historyEtag(h, "/"+strconv.Itoa(seq))
+	writeCached(w, r, "image/svg+xml", layoutEtag(etag, layout), h.Block.LastModified(), model.EncodeSvg(decl, svgOpts))
+}
@@ -3,29 +3,41 @@ package service
 import (
 	"context"
 	"fmt"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
 	"time"
 )
 
+// Loop reports sync metrics for each chain at the chain's own poll interval.
 func Loop(ctx context.Context) {
-	fmt.Println("Starting goroutine")
-	ticker := time.NewTicker(30 * time.Second)
+	for _, chain := range contract.Chains() {
+		loopChain(ctx, chain)
+	}
+}
+
+func loopChain(ctx context.Context, chain contract.Chain) {
+	fmt.Println("Starting goroutine for chain", chain.Name)
+	interval := chain.PollInterval()
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
 
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
-				stats, err := GetBlockStats()
+				stats, err := GetBlockStats(chain.ID)
 				if err != nil {
-					fmt.Println("Error getting block stats:", err)
+					fmt.Println("Error getting block stats:", chain.Name, err)
 					continue
 				}
-				Metric("block_latest", float64(stats.Latest))
-				Metric("block_highest_index", float64(stats.HighestIndex))
-				Metric("block_behind", float64(stats.Behind))
+				Metric(chain.Name+"/block_latest", float64(stats.Latest))
+				Metric(chain.Name+"/block_highest_index", float64(stats.HighestIndex))
+				Metric(chain.Name+"/block_behind", float64(stats.Behind))
 				// REVIEW: consider loading un-synced blocks into a queue & preserve last seen block
 			case <-ctx.Done():
 				ticker.Stop()
-				fmt.Println("Stopping goroutine")
+				fmt.Println("Stopping goroutine for chain", chain.Name)
 				return
 			}
 		}
@@ -2,34 +2,33 @@ package service
 
 import (
 	"encoding/json"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/stackdump/on-chain-summer-2024/internal/contract"
-	"math/big"
 	"net/http"
 )
 
-func GetContractState(net contract.ModelPetriNet) ([]int64, error) {
-	contract.Connect()
-	call, _ := contract.NewMetamodelCaller(contract.Address, contract.Backend())
-	state := make([]int64, len(net.Places))
-	for _, p := range net.Places {
-		bigOffset := new(big.Int).SetInt64(int64(p.Offset))
-		scalar, err := call.State(nil, bigOffset)
-		if err != nil {
-			return state, err
-		}
-		state[p.Offset] = scalar.Int64()
-	}
-	return state, nil
+// GetContractState reads the state vector from the deployment's source.
+func GetContractState(d contract.Deployment, net contract.ModelPetriNet, opts *bind.CallOpts) ([]int64, error) {
+	return SourceOf(d).State(net, opts)
 }
 
 func StateHandler(w http.ResponseWriter, r *http.Request) {
-	contract.Connect()
-	call, _ := contract.NewMetamodelCaller(contract.Address, contract.Backend())
-	net, _ := call.Model(nil)
-	state, err := GetContractState(net)
+	opts, err := blockCallOpts(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	d := RequestDeployment(r)
+	net, err := GetModel(d, opts)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	state, err := GetContractState(d, net, opts)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
-	json.NewEncoder(w).Encode(state)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(state)
 }
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"github.com/stackdump/on-chain-summer-2024/internal/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RenderPng rasterizes the drawing RenderSvg makes, scaled to width pixels, 0 keeps its size.
+// Drawings without a snapshot never change and are cached.
+func RenderPng(d contract.Deployment, opts *bind.CallOpts, req SvgRequest, width int) ([]byte, error) {
+	render := func() (any, error) {
+		svgOpts, err := SvgOptions(d, opts, req)
+		if err != nil {
+			return nil, err
+		}
+		decl, err := GetLayout(d, opts, req.Layout)
+		if err != nil {
+			return nil, err
+		}
+		data, err := model.EncodePng(decl, svgOpts, width)
+		if err != nil {
+			return nil, InvalidInput("%s", err.Error())
+		}
+		return data, nil
+	}
+	if req.Snapshot != nil {
+		data, err := render()
+		if err != nil {
+			return nil, err
+		}
+		return data.([]byte), nil
+	}
+	value, err := Immutable.Get(cacheKey(d, "png", req.Layout, req.RoleColors, width), 0, render)
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+// PngHandler serves the model diagram as a PNG for previews that cannot show SVG.
+// It takes the same ?color=, ?state= and ?layout= as SvgHandler, and ?width= in pixels.
+func PngHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := blockCallOpts(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	width := 0
+	if value := r.URL.Query().Get("width"); value != "" {
+		width, err = strconv.Atoi(value)
+		if err != nil || width <= 0 || width > model.MaxPngWidth {
+			WriteError(w, r, InvalidInput("width must be between 1 and %d: %s", model.MaxPngWidth, value))
+			return
+		}
+	}
+	d := RequestDeployment(r)
+	req, etag, modified, err := svgRequest(r, d, "png")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	data, err := RenderPng(d, opts, req, width)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	writeCached(w, r, "image/png", strings.TrimSuffix(etag, `"`)+"/"+strconv.Itoa(width)+`"`, modified, data)
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Contract is a model contract followed by the indexer and served under /v0/contracts/{address}.
+type Contract struct {
+	ChainID         int64          `json:"chain_id"`
+	Address         common.Address `json:"address"`
+	Label           string         `json:"label"`
+	DeploymentBlock int            `json:"deployment_block"`
+	// BackfillBlock is the next block the indexer backfills for a contract registered after it
+	// passed the deployment block, events after it may be missing until it is nil.
+	BackfillBlock *int `json:"backfill_block,omitempty"`
+}
+
+func (c Contract) Deployment() contract.Deployment {
+	return contract.Deployment{ChainID: c.ChainID, Address: c.Address}
+}
+
+// AdminToken guards the admin API, an empty token disables it.
+var AdminToken string
+
+// Routes are the per-contract endpoints, each is served at /v0/{name},
+// /v0/contracts/{address}/{name} and /v0/chains/{chain_id}/contracts/{address}/{name}.
+var Routes = map[string]http.HandlerFunc{
+	"snapshot":         SnapshotHandler,
+	"state":            StateHandler,
+	"svg":              SvgHandler,
+	"png":              PngHandler,
+	"declaration":      DeclarationHandler,
+	"logs":             LogsHandler,
+	"events":           EventsHandler,
+	"highest_index":    HighestIndexHandler,
+	"roles":            RolesHandler,
+	"history":          HistoryHandler,
+	"history/svg":      HistoryStepHandler,
+	"simulate":         SimulateHandler,
+	"svg/heatmap":      HeatmapHandler,
+	"diff":             DiffHandler,
+	"declaration/diff": ModelDiffHandler,
+}
+
+var errContractNotFound = ContractNotFound("contract not registered")
+
+const contractColumns = `chain_id, address, label, deployment_block, backfill_block`
+
+func ListContracts() ([]Contract, error) {
+	return queryContracts(`SELECT ` + contractColumns + ` FROM contracts ORDER BY created_at, chain_id, address`)
+}
+
+// FindContracts returns every registration of address, one per chain it is deployed on.
+func FindContracts(address common.Address) ([]Contract, error) {
+	return queryContracts(`SELECT `+contractColumns+` FROM contracts WHERE address = $1 ORDER BY chain_id`, strings.ToLower(address.Hex()))
+}
+
+func GetContract(d contract.Deployment) (*Contract, error) {
+	if Psql == nil {
+		return nil, errNoDatabase
+	}
+	row := Psql.QueryRow(`SELECT `+contractColumns+` FROM contracts WHERE chain_id = $1 AND address = $2`, d.ChainID, strings.ToLower(d.Address.Hex()))
+	c, err := scanContract(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errContractNotFound
+	}
+	return c, Database(err)
+}
+
+func RegisterContract(c Contract) error {
+	if Psql == nil {
+		return errNoDatabase
+	}
+	_, err := Psql.Exec(`
+  INSERT INTO contracts (chain_id, address, label, deployment_block)
+  VALUES ($1, $2, $3, $4)
+  ON CONFLICT (chain_id, address) DO UPDATE
+  SET label = EXCLUDED.label, deployment_block = EXCLUDED.deployment_block
+ `, c.ChainID, strings.ToLower(c.Address.Hex()), c.Label, c.DeploymentBlock)
+	return Database(err)
+}
+
+func RemoveContract(d contract.Deployment) error {
+	if Psql == nil {
+		return errNoDatabase
+	}
+	result, err := Psql.Exec(`DELETE FROM contracts WHERE chain_id = $1 AND address = $2`, d.ChainID, strings.ToLower(d.Address.Hex()))
+	if err != nil {
+		return Database(err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errContractNotFound
+	}
+	return nil
+}
+
+func queryContracts(query string, args ...any) ([]Contract, error) {
+	if Psql == nil {
+		return nil, errNoDatabase
+	}
+	rows, err := Psql.Query(query, args...)
+	if err != nil {
+		return nil, Database(err)
+	}
+	defer rows.Close()
+
+	contracts := []Contract{}
+	for rows.Next() {
+		c, err := scanContract(rows)
+		if err != nil {
+			return nil, Database(err)
+		}
+		contracts = append(contracts, *c)
+	}
+	return contracts, Database(rows.Err())
+}
+
+func scanContract(row interface{ Scan(...any) error }) (*Contract, error) {
+	var c Contract
+	var address string
+	err := row.Scan(&c.ChainID, &address, &c.Label, &c.DeploymentBlock, &c.BackfillBlock)
+	if err != nil {
+		return nil, err
+	}
+	c.Address = common.HexToAddress(address)
+	return &c, nil
+}
+
+type deploymentKey struct{}
+
+// RequestDeployment is the contract selected by the /v0/contracts/{address} routes, or the default contract.
+func RequestDeployment(r *http.Request) contract.Deployment {
+	if d, ok := r.Context().Value(deploymentKey{}).(contract.Deployment); ok {
+		return d
+	}
+	return contract.Default()
+}
+
+// ContractsHandler lists registered contracts at /v0/contracts and serves
+// /v0/contracts/{address}/{route} by dispatching to Routes with the contract bound to the request.
+// An address deployed on several chains is disambiguated with ?chain_id=, otherwise the default chain wins.
+func ContractsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v0/contracts"), "/")
+	if path == "" {
+		contracts, err := ListContracts()
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		writeJson(w, http.StatusOK, contracts)
+		return
+	}
+
+	hexAddress, route, _ := strings.Cut(path, "/")
+	if !common.IsHexAddress(hexAddress) {
+		WriteError(w, r, InvalidInput("invalid address: %s", hexAddress))
+		return
+	}
+	contracts, err := FindContracts(common.HexToAddress(hexAddress))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if chainParam := r.URL.Query().Get("chain_id"); chainParam != "" {
+		chainID, err := strconv.ParseInt(chainParam, 10, 64)
+		if err != nil {
+			WriteError(w, r, InvalidInput("invalid chain_id: %s", chainParam))
+			return
+		}
+		contracts = filterChain(contracts, chainID)
+	}
+	if len(contracts) == 0 {
+		WriteError(w, r, errContractNotFound)
+		return
+	}
+	selected := contracts[0]
+	for _, c := range contracts {
+		if c.ChainID == contract.ChainID {
+			selected = c
+		}
+	}
+	serveContract(w, r, selected, route)
+}
+
+// ChainsHandler lists chains at /v0/chains and serves /v0/chains/{chain_id}/contracts/{address}/{route}.
+func ChainsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v0/chains"), "/")
+	if path == "" {
+		chains, err := ListChains()
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		for i := range chains {
+			chains[i].Endpoints = nil // endpoints may embed API keys
+		}
+		writeJson(w, http.StatusOK, chains)
+		return
+	}
+
+	parts := strings.SplitN(path, "/", 4)
+	chainID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		WriteError(w, r, InvalidInput("invalid chain_id: %s", parts[0]))
+		return
+	}
+	if len(parts) < 3 || parts[1] != "contracts" {
+		WriteError(w, r, NotFound("no route for %s", r.URL.Path))
+		return
+	}
+	if !common.IsHexAddress(parts[2]) {
+		WriteError(w, r, InvalidInput("invalid address: %s", parts[2]))
+		return
+	}
+	c, err := GetContract(contract.Deployment{ChainID: chainID, Address: common.HexToAddress(parts[2])})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	route := ""
+	if len(parts) == 4 {
+		route = parts[3]
+	}
+	serveContract(w, r, *c, route)
+}
+
+func serveContract(w http.ResponseWriter, r *http.Request, c Contract, route string) {
+	if route == "" {
+		writeJson(w, http.StatusOK, c)
+		return
+	}
+	handler, ok := Routes[route]
+	if !ok {
+		WriteError(w, r, NotFound("no route for %s", r.URL.Path))
+		return
+	}
+	handler(w, r.WithContext(context.WithValue(r.Context(), deploymentKey{}, c.Deployment())))
+}
+
+func filterChain(contracts []Contract, chainID int64) []Contract {
+	var out []Contract
+	for _, c := range contracts {
+		if c.ChainID == chainID {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	given := []byte(r.Header.Get("Authorization"))
+	if AdminToken == "" || subtle.ConstantTimeCompare(given, []byte("Bearer "+AdminToken)) != 1 {
+		WriteError(w, r, &Error{Kind: KindForbidden, Message: "admin token required"})
+		return false
+	}
+	return true
+}
+
+// AdminContractsHandler manages the registry: GET lists, POST upserts a Contract,
+// DELETE ?chain_id=&address= removes one.
+func AdminContractsHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		contracts, err := ListContracts()
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		writeJson(w, http.StatusOK, contracts)
+	case http.MethodPost:
+		var c Contract
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			WriteError(w, r, InvalidInput("invalid contract: %v", err))
+			return
+		}
+		if c.Address == (common.Address{}) || c.ChainID == 0 {
+			WriteError(w, r, InvalidInput("address and chain_id are required"))
+			return
+		}
+		if _, ok := contract.GetChain(c.ChainID); !ok {
+			WriteError(w, r, InvalidInput("unknown chain_id: %d", c.ChainID))
+			return
+		}
+		if err := RegisterContract(c); err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		registered, err := GetContract(c.Deployment())
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		Event("contract_registered", map[string]interface{}{"chain_id": c.ChainID, "address": c.Address.Hex(), "label": c.Label, "backfill_block": registered.BackfillBlock})
+		writeJson(w, http.StatusCreated, registered)
+	case http.MethodDelete:
+		hexAddress := r.URL.Query().Get("address")
+		chainID, err := strconv.ParseInt(r.URL.Query().Get("chain_id"), 10, 64)
+		if err != nil || !common.IsHexAddress(hexAddress) {
+			WriteError(w, r, InvalidInput("chain_id and address are required"))
+			return
+		}
+		err = RemoveContract(contract.Deployment{ChainID: chainID, Address: common.HexToAddress(hexAddress)})
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		Event("contract_removed", map[string]interface{}{"chain_id": chainID, "address": hexAddress})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		WriteError(w, r, &Error{Kind: KindMethodNotAllowed, Message: "method not allowed"})
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testAddress = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+
+func TestRegistryRouting(t *testing.T) {
+	Logger = log.New(io.Discard, "", 0)
+	Psql = nil
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		status  int
+		code    ErrorKind
+	}{
+		{name: "list contracts", handler: ContractsHandler, path: "/v0/contracts", status: http.StatusServiceUnavailable, code: KindDatabase},
+		{name: "invalid address", handler: ContractsHandler, path: "/v0/contracts/0x1234/snapshot", status: http.StatusBadRequest, code: KindInvalidInput},
+		{name: "contract lookup", handler: ContractsHandler, path: "/v0/contracts/" + testAddress + "/snapshot", status: http.StatusServiceUnavailable, code: KindDatabase},
+		{name: "list chains", handler: ChainsHandler, path: "/v0/chains", status: http.StatusServiceUnavailable, code: KindDatabase},
+		{name: "invalid chain", handler: ChainsHandler, path: "/v0/chains/mainnet/contracts/" + testAddress, status: http.StatusBadRequest, code: KindInvalidInput},
+		{name: "chain route", handler: ChainsHandler, path: "/v0/chains/1/blocks", status: http.StatusNotFound, code: KindNotFound},
+		{name: "chain invalid address", handler: ChainsHandler, path: "/v0/chains/1/contracts/0x1234", status: http.StatusBadRequest, code: KindInvalidInput},
+		{name: "chain contract lookup", handler: ChainsHandler, path: "/v0/chains/1/contracts/" + testAddress + "/state", status: http.StatusServiceUnavailable, code: KindDatabase},
+		{name: "admin disabled", handler: AdminContractsHandler, path: "/v0/admin/contracts", status: http.StatusForbidden, code: KindForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tc.handler(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if w.Code != tc.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+			var body struct {
+				Error struct {
+					Code ErrorKind `json:"code"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error.Code != tc.code {
+				t.Errorf("code %s, want %s", body.Error.Code, tc.code)
+			}
+		})
+	}
+}
+
+func TestServeContract(t *testing.T) {
+	Logger = log.New(io.Discard, "", 0)
+	c := Contract{ChainID: 31337, Address: common.HexToAddress(testAddress), Label: "jetsam"}
+	Routes["test/deployment"] = func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, RequestDeployment(r))
+	}
+	defer delete(Routes, "test/deployment")
+
+	for _, tc := range []struct {
+		name   string
+		route  string
+		status int
+		want   any
+	}{
+		{name: "contract", route: "", status: http.StatusOK, want: c},
+		{name: "bound deployment", route: "test/deployment", status: http.StatusOK, want: c.Deployment()},
+		{name: "unknown route", route: "nope", status: http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			serveContract(w, httptest.NewRequest(http.MethodGet, "/v0/contracts/"+testAddress+"/"+tc.route, nil), c, tc.route)
+			if w.Code != tc.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+			if tc.want != nil {
+				want, _ := json.Marshal(tc.want)
+				if got := w.Body.String(); got != string(want)+"\n" {
+					t.Errorf("body %s, want %s", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"github.com/stackdump/on-chain-summer-2024/internal/model"
+	"strings"
+)
+
+// logWindow keeps eth_getLogs ranges small enough for hosted RPC providers.
+const logWindow = 5000
+
+// Signal is one SignaledEvent emitted by the contract.
+type Signal struct {
+	BlockNumber     uint64 `json:"block_number"`
+	TransactionHash string `json:"transaction_hash"`
+	LogIndex        uint   `json:"log_index"`
+	Role            uint8  `json:"role"`
+	Action          uint8  `json:"action"`
+	Label           string `json:"label"`
+	Scalar          int64  `json:"scalar"`
+	Sender          string `json:"sender,omitempty"` // the transaction's sender, known to the indexer
+}
+
+// ReadSignals reads signals between two blocks, inclusive, from the indexed transaction logs
+// or, without a database, from the chain.
+func ReadSignals(d contract.Deployment, net contract.ModelPetriNet, from, to uint64) ([]Signal, error) {
+	if Psql == nil {
+		return GetSignals(d, net, from, to)
+	}
+	return IndexedSignals(d, net, from, to)
+}
+
+// GetSignals reads the contract's SignaledEvent logs between two blocks, inclusive.
+func GetSignals(d contract.Deployment, net contract.ModelPetriNet, from, to uint64) ([]Signal, error) {
+	filterer, err := d.Filterer()
+	if err != nil {
+		return nil, Upstream(err)
+	}
+	signals := []Signal{}
+	for start := from; start <= to; start += logWindow {
+		end := min(start+logWindow-1, to)
+		it, err := filterer.FilterSignaledEvent(&bind.FilterOpts{Start: start, End: &end}, nil, nil, nil)
+		if err != nil {
+			return nil, Upstream(err)
+		}
+		for it.Next() {
+			e := it.Event
+			if e.Raw.Removed {
+				continue
+			}
+			s := Signal{
+				BlockNumber:     e.Raw.BlockNumber,
+				TransactionHash: e.Raw.TxHash.Hex(),
+				LogIndex:        e.Raw.Index,
+				Role:            e.Role,
+				Action:          e.ActionId,
+				Scalar:          e.Scalar.Int64(),
+			}
+			if int(e.ActionId) < len(net.Transitions) {
+				s.Label = net.Transitions[e.ActionId].Label
+			}
+			signals = append(signals, s)
+		}
+		err = it.Error()
+		_ = it.Close()
+		if err != nil {
+			return nil, Upstream(err)
+		}
+	}
+	return signals, nil
+}
+
+// IndexedSignals reads SignaledEvent logs between two blocks, inclusive, from the transactions table.
+func IndexedSignals(d contract.Deployment, net contract.ModelPetriNet, from, to uint64) ([]Signal, error) {
+	if Psql == nil {
+		return nil, errNoDatabase
+	}
+	metamodel, err := contract.MetamodelMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	address := strings.ToLower(d.Address.Hex())
+	rows, err := Psql.Query(`
+  SELECT
+   t.block_number,
+   t.transaction_hash,
+   l.log_index,
+   l.entry->'topics'->>1,
+   l.entry->'topics'->>2,
+   l.entry->'topics'->>3,
+   coalesce(t.transaction_details->'result'->>'from', '')
+  FROM
+   transactions t,
+   jsonb_array_elements(t.logs) WITH ORDINALITY AS l(entry, log_index)
+  WHERE
+   t.chain_id = $1 AND t.address = $2 AND t.block_number BETWEEN $3 AND $4
+   AND lower(l.entry->>'address') = $2
+   AND l.entry->'topics'->>0 = $5
+   AND NOT coalesce((l.entry->>'removed')::boolean, false)
+  ORDER BY
+   t.block_number, l.log_index
+ `, d.ChainID, address, from, to, metamodel.Events["SignaledEvent"].ID.Hex())
+	if err != nil {
+		return nil, Database(err)
+	}
+	defer rows.Close()
+
+	signals := []Signal{}
+	for rows.Next() {
+		var s Signal
+		var role, action, scalar string
+		if err := rows.Scan(&s.BlockNumber, &s.TransactionHash, &s.LogIndex, &role, &action, &scalar, &s.Sender); err != nil {
+			return nil, Database(err)
+		}
+		s.Role = uint8(common.HexToHash(role).Big().Uint64())
+		s.Action = uint8(common.HexToHash(action).Big().Uint64())
+		s.Scalar = common.HexToHash(scalar).Big().Int64()
+		if int(s.Action) < len(net.Transitions) {
+			s.Label = net.Transitions[s.Action].Label
+		}
+		signals = append(signals, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Database(err)
+	}
+	return signals, nil
+}
+
+// Step is the state after a signal, Error is set when the signal could not be applied off chain.
+// Sequence counts signals from 1 when the history starts at the deployment block.
+type Step struct {
+	Signal
+	Sequence int     `json:"sequence"`
+	State    []int64 `json:"state"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// History is the contract state rebuilt from its event log.
+type History struct {
+	ChainID  int64    `json:"chain_id"`
+	Address  string   `json:"address"`
+	Block    *Block   `json:"block"`
+	Places   []string `json:"places"`
+	Initial  []int64  `json:"initial"`
+	Steps    []Step   `json:"steps"`
+	State    []int64  `json:"state"`
+	OnChain  []int64  `json:"on_chain"`
+	Diverged bool     `json:"diverged"`
+}
+
+// Replay fires every signal since the deployment block against the initial state and compares
+// the result with the contract state read at the same block.
+func Replay(d contract.Deployment, deploymentBlock uint64, block *Block) (*History, error) {
+	opts := block.CallOpts()
+	net, err := GetModel(d, opts)
+	if err != nil {
+		return nil, err
+	}
+	signals, err := ReadSignals(d, net, deploymentBlock, block.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &History{
+		ChainID: d.ChainID,
+		Address: d.Address.Hex(),
+		Block:   block,
+		Places:  make([]string, len(net.Places)),
+		Initial: InitialState(net),
+		Steps:   make([]Step, 0, len(signals)),
+	}
+	for _, p := range net.Places {
+		h.Places[p.Offset] = p.Label
+	}
+
+	state := h.Initial
+	for _, s := range signals {
+		step := Step{Signal: s, Sequence: len(h.Steps) + 1}
+		state, err = Fire(net, state, int(s.Action), s.Scalar)
+		if err != nil {
+			step.Error = err.Error()
+		}
+		step.State = state
+		h.Steps = append(h.Steps, step)
+	}
+	h.State = state
+
+	h.OnChain, err = GetContractState(d, net, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range h.State {
+		if h.State[i] != h.OnChain[i] {
+			h.Diverged = true
+		}
+	}
+	return h, nil
+}
+
+// TransactionSender recovers the account that sent a transaction.
+func TransactionSender(chainID int64, hash string) (common.Address, error) {
+	client, err := contract.Dial(chainID)
+	if err != nil {
+		return common.Address{}, Upstream(err)
+	}
+	tx, _, err := client.TransactionByHash(context.Background(), common.HexToHash(hash))
+	if err != nil {
+		return common.Address{}, Upstream(err)
+	}
+	return types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+}
+
+// FillSenders looks up the sender of steps read from the chain, the indexer already knows them.
+func FillSenders(d contract.Deployment, steps []Step) error {
+	senders := map[string]string{}
+	for i, step := range steps {
+		if step.Sender != "" {
+			continue
+		}
+		sender, ok := senders[step.TransactionHash]
+		if !ok {
+			address, err := TransactionSender(d.ChainID, step.TransactionHash)
+			if err != nil {
+				return err
+			}
+			sender = address.Hex()
+			senders[step.TransactionHash] = sender
+		}
+		steps[i].Sender = sender
+	}
+	return nil
+}
+
+// ReplayFrames turns a history into animation frames: the marking before the first step, then
+// the marking after each step with its transition firing. With a player only the signals of
+// transactions they sent get a frame, the state still includes everyone's moves.
+func ReplayFrames(d contract.Deployment, h *History, player *common.Address) ([]model.Frame, error) {
+	if player != nil {
+		if err := FillSenders(d, h.Steps); err != nil {
+			return nil, err
+		}
+	}
+	var frames []model.Frame
+	before := h.Initial
+	for _, step := range h.Steps {
+		if player != nil {
+			if common.HexToAddress(step.Sender) != *player {
+				before = step.State
+				continue
+			}
+		}
+		if frames == nil {
+			caption := "initial marking"
+			if player != nil {
+				caption = fmt.Sprintf("before block %d", step.BlockNumber)
+			}
+			frames = append(frames, model.Frame{State: before, Caption: caption})
+		}
+		caption := fmt.Sprintf("block %d: %s x%d", step.BlockNumber, step.Label, step.Scalar)
+		if step.Error != "" {
+			caption += " (" + step.Error + ")"
+		}
+		frames = append(frames, model.Frame{State: step.State, Firing: step.Label, Caption: caption})
+		before = step.State
+	}
+	if frames == nil {
+		return nil, NotFound("no signals to replay")
+	}
+	return frames, nil
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"github.com/stackdump/on-chain-summer-2024/internal/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role is a role of the model with the actions it may signal.
+type Role struct {
+	Role    uint8    `json:"role"`
+	Label   string   `json:"label"`
+	Granted bool     `json:"granted"` // the contract's getRoles includes it
+	Actions []string `json:"actions"`
+}
+
+var (
+	roleLabelsMu sync.RWMutex
+	roleLabels   = map[contract.Deployment][]string{}
+)
+
+// SetRoleLabels names a deployment's roles by number, the contract itself only knows the numbers.
+func SetRoleLabels(d contract.Deployment, labels []string) {
+	roleLabelsMu.Lock()
+	defer roleLabelsMu.Unlock()
+	roleLabels[d] = labels
+}
+
+func getRoleLabels(d contract.Deployment) []string {
+	roleLabelsMu.RLock()
+	defer roleLabelsMu.RUnlock()
+	return roleLabels[d]
+}
+
+// GetRoles lists every role the model uses or the contract grants, in role order. Unnamed roles
+// are labelled the way model.RoleNames names them in generated contracts. Grants change on chain,
+// so roles are cached per block and only briefly for the latest block.
+func GetRoles(d contract.Deployment, net contract.ModelPetriNet, opts *bind.CallOpts) ([]Role, error) {
+	key, ttl := cacheKey(d, "roles", "latest"), latestBlockTtl
+	if opts != nil && opts.BlockNumber != nil {
+		key, ttl = cacheKey(d, "roles", opts.BlockNumber), 0
+	}
+	value, err := Snapshots.Get(key, ttl, func() (any, error) {
+		granted, err := SourceOf(d).Roles(net, opts)
+		if err != nil {
+			return nil, err
+		}
+		maxRole := 0
+		for _, t := range net.Transitions {
+			maxRole = max(maxRole, int(t.Role))
+		}
+		for _, role := range granted {
+			maxRole = max(maxRole, int(role))
+		}
+		labels := getRoleLabels(d)
+		names := model.RoleNames(maxRole, nil)
+		roles := make([]Role, len(names))
+		for i := range roles {
+			roles[i] = Role{Role: uint8(i), Label: names[i], Actions: []string{}}
+			if i < len(labels) && labels[i] != "" {
+				roles[i].Label = labels[i]
+			}
+		}
+		for _, role := range granted {
+			roles[role].Granted = true
+		}
+		for _, t := range net.Transitions {
+			roles[t.Role].Actions = append(roles[t.Role].Actions, t.Label)
+		}
+		return roles, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]Role), nil
+}
+
+// ParseRole reads a role by label, case-insensitively, or by number.
+func ParseRole(value string, roles []Role) (uint8, error) {
+	for _, role := range roles {
+		if strings.EqualFold(role.Label, value) {
+			return role.Role, nil
+		}
+	}
+	n, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || int(n) >= len(roles) {
+		return 0, InvalidInput("unknown role: %s", value)
+	}
+	return uint8(n), nil
+}
+
+// requestRole is the role given with ?role=, nil when the request has none.
+func requestRole(r *http.Request, roles []Role) (*uint8, error) {
+	value := r.URL.Query().Get("role")
+	if value == "" {
+		return nil, nil
+	}
+	role, err := ParseRole(value, roles)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// RolesHandler serves the model's roles and their actions, ?role= selects one.
+func RolesHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := blockCallOpts(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	d := RequestDeployment(r)
+	net, err := GetModel(d, opts)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	roles, err := GetRoles(d, net, opts)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	role, err := requestRole(r, roles)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	etag := strings.TrimSuffix(declarationEtag(d), `"`) + "/roles"
+	if role != nil {
+		roles = roles[*role : *role+1]
+		etag += "/" + strconv.Itoa(int(*role))
+	}
+	data, err := json.Marshal(roles)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	writeCached(w, r, "application/json", etag+`"`, time.Time{}, append(data, '\n'))
+}
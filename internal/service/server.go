@@ -10,6 +10,8 @@ import "database/sql"
 
 var Psql *sql.DB
 
+var errNoDatabase = &Error{Kind: KindDatabase, Message: "database not configured"}
+
 var Apm *newrelic.Application
 
 var Logger *log.Logger
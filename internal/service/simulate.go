@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+var (
+	ErrUnknownAction = errors.New("unknown action")
+	ErrInhibited     = errors.New("transition inhibited")
+	ErrUnderflow     = errors.New("underflow")
+	ErrOverflow      = errors.New("overflow")
+	ErrInvalidScalar = errors.New("invalid scalar")
+)
+
+// InitialState is the state a freshly deployed contract starts from.
+func InitialState(net contract.ModelPetriNet) []int64 {
+	state := make([]int64, len(net.Places))
+	for _, p := range net.Places {
+		state[p.Offset] = p.Initial.Int64()
+	}
+	return state
+}
+
+// ActionOffset finds a transition by label.
+func ActionOffset(net contract.ModelPetriNet, label string) (int, bool) {
+	for _, t := range net.Transitions {
+		if t.Label == label {
+			return int(t.Offset), true
+		}
+	}
+	return 0, false
+}
+
+// Fire applies action to a copy of state the way MyStateMachine does on chain:
+// guards are checked against the current state, then delta*scalar is added to each place,
+// failing on underflow, when a place with a capacity overflows or when a place leaves the int8
+// the contract stores it in. The contract takes the scalar as a uint8.
+func Fire(net contract.ModelPetriNet, state []int64, action int, scalar int64) ([]int64, error) {
+	if action < 0 || action >= len(net.Transitions) {
+		return state, &Error{Kind: KindInvalidInput, Message: "action out of range", Err: ErrUnknownAction}
+	}
+	t := net.Transitions[action]
+	if scalar <= 0 || scalar > math.MaxUint8 {
+		return state, &Error{Kind: KindInvalidInput, Message: t.Label, Err: ErrInvalidScalar}
+	}
+
+	for i, g := range t.Guard {
+		guard := g.Int64()
+		if guard < 0 && state[i]+guard > 0 || guard > 0 && state[i]-guard < 0 {
+			return state, &Error{Kind: KindInvalidInput, Message: t.Label + " guarded by " + net.Places[i].Label, Err: ErrInhibited}
+		}
+	}
+
+	next := append([]int64(nil), state...)
+	for i, d := range t.Delta {
+		delta := d.Int64()
+		if delta == 0 {
+			continue
+		}
+		next[i] += delta * scalar
+		if next[i] < 0 {
+			return state, &Error{Kind: KindInvalidInput, Message: t.Label + " empties " + net.Places[i].Label, Err: ErrUnderflow}
+		}
+		if capacity := net.Places[i].Capacity.Int64(); capacity > 0 && next[i] > capacity || next[i] > math.MaxInt8 {
+			return state, &Error{Kind: KindInvalidInput, Message: t.Label + " fills " + net.Places[i].Label, Err: ErrOverflow}
+		}
+	}
+	return next, nil
+}
+
+// Enabled reports for each transition whether a single firing succeeds in state,
+// and whether it is blocked by a guard rather than by tokens or capacity.
+func Enabled(net contract.ModelPetriNet, state []int64) (enabled, inhibited []bool) {
+	enabled = make([]bool, len(net.Transitions))
+	inhibited = make([]bool, len(net.Transitions))
+	for i := range net.Transitions {
+		_, err := Fire(net, state, i, 1)
+		enabled[i] = err == nil
+		inhibited[i] = errors.Is(err, ErrInhibited)
+	}
+	return enabled, inhibited
+}
+
+// DryRun is the outcome of firing one action against a live state without sending a transaction.
+type DryRun struct {
+	Action string  `json:"action"`
+	Scalar int64   `json:"scalar"`
+	Block  *Block  `json:"block"`
+	State  []int64 `json:"state"`
+	Next   []int64 `json:"next,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// SimulateHandler fires ?action=, a label or offset, ?scalar= times against the state at ?block=.
+// A signal the contract would reject is reported in the result's error, not as a failed request.
+func SimulateHandler(w http.ResponseWriter, r *http.Request) {
+	s, err := liveState(r, RequestDeployment(r))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	query := r.URL.Query()
+	action, ok := ActionOffset(s.Model, query.Get("action"))
+	if !ok {
+		n, err := strconv.Atoi(query.Get("action"))
+		if err != nil || n < 0 || n >= len(s.Model.Transitions) {
+			WriteError(w, r, InvalidInput("unknown action: %s", query.Get("action")))
+			return
+		}
+		action = n
+	}
+	scalar := int64(1)
+	if value := query.Get("scalar"); value != "" {
+		scalar, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || scalar < 1 || scalar > math.MaxUint8 {
+			WriteError(w, r, InvalidInput("scalar must be between 1 and %d: %s", math.MaxUint8, value))
+			return
+		}
+	}
+	result := DryRun{Action: s.Model.Transitions[action].Label, Scalar: scalar, Block: s.Block, State: s.State}
+	next, err := Fire(s.Model, s.State, action, scalar)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Next = next
+	}
+	writeJson(w, http.StatusOK, result)
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"github.com/stackdump/on-chain-summer-2024/internal/model"
+	"testing"
+)
+
+func TestFire(t *testing.T) {
+	net, err := model.NewBuilder().
+		Cell("a", 0, 0, model.Position(0, 0)).Cell("b", 0, 5, model.Position(2, 0)).
+		Func("fill", 0, model.Position(1, 0)).Func("move", 0, model.Position(1, 1)).
+		Arrow(1, "fill", "a").Arrow(1, "a", "move").Arrow(1, "move", "b").
+		Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		state  []int64
+		action int
+		scalar int64
+		want   []int64
+		err    error
+	}{
+		{name: "fill", state: []int64{0, 0}, action: 0, scalar: 1, want: []int64{1, 0}},
+		{name: "largest scalar", state: []int64{0, 0}, action: 0, scalar: 127, want: []int64{127, 0}},
+		{name: "int8 overflow", state: []int64{1, 0}, action: 0, scalar: 127, err: ErrOverflow},
+		{name: "uint8 scalar", state: []int64{0, 0}, action: 0, scalar: 256, err: ErrInvalidScalar},
+		{name: "zero scalar", state: []int64{0, 0}, action: 0, scalar: 0, err: ErrInvalidScalar},
+		{name: "underflow", state: []int64{0, 0}, action: 1, scalar: 1, err: ErrUnderflow},
+		{name: "capacity", state: []int64{10, 0}, action: 1, scalar: 6, err: ErrOverflow},
+		{name: "unknown action", state: []int64{0, 0}, action: 2, scalar: 1, err: ErrUnknownAction},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			next, err := Fire(net, tc.state, tc.action, tc.scalar)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("err = %v, want %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range tc.want {
+				if next[i] != tc.want[i] {
+					t.Errorf("next = %v, want %v", next, tc.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -1,25 +1,65 @@
 package service
 
 import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/pflow-dev/pflow-xyz/protocol/metamodel"
 	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"github.com/stackdump/on-chain-summer-2024/internal/model"
+	"math/big"
 	"net/http"
 	"strconv"
 	"strings"
 )
 
-func NewSnapshot() *Snapshot {
+// NewSnapshot reads the contract at a single block, nil means the latest block.
+// Snapshots are cached per block, concurrent requests for the same block share one read.
+// Block stats follow the indexer, they are shared across blocks and refreshed every blockStatsTtl.
+func NewSnapshot(d contract.Deployment, blockNumber *big.Int) (*Snapshot, error) {
+	block, err := ResolveBlock(d, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey(d, "snapshot", block.Number)
+	value, err := Snapshots.Get(key, 0, func() (any, error) {
+		return loadSnapshot(d, block)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := *value.(*Snapshot)
+	if s.partial {
+		Snapshots.Delete(key)
+	}
+
+	// block stats come from the indexer, a snapshot is still useful without them
+	s.BlockStats, err = CachedBlockStats(d.ChainID)
+	if err != nil {
+		Logger.Printf("snapshot %s: block stats unavailable: %v\n", d, err)
+	}
+	return &s, nil
+}
+
+func loadSnapshot(d contract.Deployment, block *Block) (*Snapshot, error) {
 	s := new(Snapshot)
 	var err error
-	s.Declaration = GetDeclaration()
-	s.Model, err = GetModel()
+	s.ChainID = d.ChainID
+	s.Address = d.Address
+	s.Block = block
+	opts := s.Block.CallOpts()
+
+	s.Declaration, err = GetDeclaration(d, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.Model, err = GetModel(d, opts)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	s.State, err = GetContractState(s.Model)
+	s.State, err = GetContractState(d, s.Model, opts)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	s.Actions = make([]string, len(s.Model.Transitions))
@@ -27,55 +67,98 @@ func NewSnapshot() *Snapshot {
 		s.Actions[mt.Offset] = mt.Label
 	}
 
-	s.BlockStats, err = GetBlockStats()
+	// a contract without getRoles still has a snapshot, only the grants are missing,
+	// it is not cached so the roles are read again
+	s.Roles, err = GetRoles(d, s.Model, opts)
+	if err != nil {
+		Logger.Printf("snapshot %s: roles unavailable: %v\n", d, err)
+		s.partial = true
+	}
 
-	return s
+	return s, nil
 }
 
 type Snapshot struct {
+	ChainID     int64                        `json:"chain_id"`
+	Address     common.Address               `json:"address"`
+	Block       *Block                       `json:"block"`
 	Declaration contract.DeclarationPetriNet `json:"declaration"`
 	Model       contract.ModelPetriNet       `json:"model"`
 	State       []int64                      `json:"state"`
 	Actions     []string                     `json:"actions"`
+	Roles       []Role                       `json:"roles"`
 	BlockStats  *BlockStats                  `json:"block_stats"`
+	role        *uint8                       // ToJson lists only this role's actions
+	partial     bool                         // roles failed to load, the snapshot is not cached
+}
+
+// ForRole is the snapshot seen by one role, its JSON lists only the actions the role may signal.
+func (s *Snapshot) ForRole(role uint8) *Snapshot {
+	filtered := *s
+	filtered.role = &role
+	return &filtered
+}
+
+// Etag identifies the contract state at the snapshot block.
+func (s *Snapshot) Etag() string {
+	return fmt.Sprintf(`"%d-%s-%d"`, s.ChainID, s.Address.Hex(), s.Block.Number)
 }
 
 func (s *Snapshot) ToMetaModel() metamodel.MetaModel {
 	return ToMetaModel(s.Declaration)
 }
 
+// ToJson is the declaration in pflow v0 JSON followed by the state, actions, roles, contract and block.
 func (s *Snapshot) ToJson() []byte {
-	// -- model --
-	modelJson, _ := ToModelJson(s.ToMetaModel())
-	out := strings.TrimSuffix(string(modelJson), "\n}") + ",\n"
-
-	// -- state --
-	out += "  \"state\": {\n"
-	for offset, state := range s.State {
-		out += "    \"" + s.Model.Places[offset].Label + "\": " + strconv.Itoa(int(state)) + ",\n"
+	state := make([]model.JsonEntry, len(s.State))
+	for offset, tokens := range s.State {
+		state[offset] = model.JsonEntry{Key: s.Model.Places[offset].Label, Value: tokens}
 	}
-	out = strings.TrimSuffix(out, ",\n") + "\n  },\n"
-
-	// -- actions --
-	out += "  \"actions\": {\n"
+	actions := []model.JsonEntry{}
 	for offset, action := range s.Actions {
-		out += "    \"" + action + "\": " + strconv.Itoa(offset) + ",\n"
+		if s.role == nil || s.Model.Transitions[offset].Role == *s.role {
+			actions = append(actions, model.JsonEntry{Key: action, Value: int64(offset)})
+		}
 	}
-	out = strings.TrimSuffix(out, ",\n") + "\n  },\n"
-
-	// -- contract --
-	out += "  \"address\": \"" + contract.Address.String() + "\",\n"
-
-	// -- block_stats --
-	block_stats, _ := GetBlockStats()
-	out += "  \"block_stats\": {\"highest_index\": " + strconv.Itoa(block_stats.HighestIndex) + ", \"latest\": " + strconv.Itoa(block_stats.Latest) + ", \"behind\": " + strconv.Itoa(block_stats.Behind) + "}\n"
-
-	out += "}\n"
-	return []byte(out)
+	roles := make([]model.JsonEntry, len(s.Roles))
+	for i, role := range s.Roles {
+		roles[i] = model.JsonEntry{Key: role.Label, Value: int64(role.Role)}
+	}
+	data, _ := model.EncodeJson(s.Declaration,
+		model.ObjectField("state", state),
+		model.ObjectField("actions", actions),
+		model.ObjectField("roles", roles),
+		model.ValueField("chain_id", s.ChainID),
+		model.ValueField("address", s.Address.Hex()),
+		model.ValueField("block", s.Block),
+		model.ValueField("block_stats", s.BlockStats),
+	)
+	return data
 }
 
-func SnapshotHandler(w http.ResponseWriter, _ *http.Request) {
-	s := NewSnapshot()
-	w.Header().Set("Content-Type", "application/json")
-	_, _ = w.Write(s.ToJson())
+func SnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	blockNumber, err := BlockParam(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	s, err := NewSnapshot(RequestDeployment(r), blockNumber)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	etag := s.Etag()
+	if s.BlockStats != nil {
+		etag = strings.TrimSuffix(etag, `"`) + "/indexed/" + strconv.Itoa(s.BlockStats.HighestIndex) + "-" + strconv.Itoa(s.BlockStats.Latest) + `"`
+	}
+	role, err := requestRole(r, s.Roles)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if role != nil {
+		s = s.ForRole(*role)
+		etag = strings.TrimSuffix(etag, `"`) + "/role/" + strconv.Itoa(int(*role)) + `"`
+	}
+	writeCached(w, r, "application/json", etag, s.Block.LastModified(), s.ToJson())
 }
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stackdump/on-chain-summer-2024/internal/contract"
+	"github.com/stackdump/on-chain-summer-2024/internal/model"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Source supplies a deployment's model and state, from the contract or from a local file.
+type Source interface {
+	Block(number *big.Int) (*Block, error)
+	Declaration(opts *bind.CallOpts) (contract.DeclarationPetriNet, error)
+	Model(opts *bind.CallOpts) (contract.ModelPetriNet, error)
+	State(net contract.ModelPetriNet, opts *bind.CallOpts) ([]int64, error)
+	Roles(net contract.ModelPetriNet, opts *bind.CallOpts) ([]uint8, error)
+}
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = map[contract.Deployment]Source{}
+)
+
+// UseSource serves d from src instead of the chain.
+func UseSource(d contract.Deployment, src Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources[d] = src
+}
+
+// SourceOf returns the source registered for d, the contract itself by default.
+func SourceOf(d contract.Deployment) Source {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	if src, ok := sources[d]; ok {
+		return src
+	}
+	return chainSource{d}
+}
+
+// chainSource reads through MetamodelCaller.
+type chainSource struct {
+	d contract.Deployment
+}
+
+func (s chainSource) Block(number *big.Int) (*Block, error) {
+	return resolveChainBlock(s.d.ChainID, number)
+}
+
+func (s chainSource) Declaration(opts *bind.CallOpts) (contract.DeclarationPetriNet, error) {
+	call, err := s.d.Caller()
+	if err != nil {
+		return contract.DeclarationPetriNet{}, Upstream(err)
+	}
+	net, err := call.Declaration(opts)
+	return net, Upstream(err)
+}
+
+func (s chainSource) Model(opts *bind.CallOpts) (contract.ModelPetriNet, error) {
+	call, err := s.d.Caller()
+	if err != nil {
+		return contract.ModelPetriNet{}, Upstream(err)
+	}
+	net, err := call.Model(opts)
+	return net, Upstream(err)
+}
+
+func (s chainSource) State(net contract.ModelPetriNet, opts *bind.CallOpts) ([]int64, error) {
+	state := make([]int64, len(net.Places))
+	call, err := s.d.Caller()
+	if err != nil {
+		return state, Upstream(err)
+	}
+	for _, p := range net.Places {
+		bigOffset := new(big.Int).SetInt64(int64(p.Offset))
+		scalar, err := call.State(opts, bigOffset)
+		if err != nil {
+			return state, Upstream(err)
+		}
+		state[p.Offset] = scalar.Int64()
+	}
+	return state, nil
+}
+
+// Roles are the roles the contract grants, its hasPermission accepts no others.
+func (s chainSource) Roles(_ contract.ModelPetriNet, opts *bind.CallOpts) ([]uint8, error) {
+	call, err := s.d.Caller()
+	if err != nil {
+		return nil, Upstream(err)
+	}
+	roles, err := call.GetRoles(opts)
+	return roles, Upstream(err)
+}
+
+// FileSource serves a pflow v0 model JSON or a saved snapshot JSON, it holds a single block.
+// A model file is served at block 0 in its initial state.
+type FileSource struct {
+	Path        string
+	Deployment  contract.Deployment
+	RoleLabels  []string // from the roles of a saved snapshot
+	block       *Block
+	declaration contract.DeclarationPetriNet
+	model       contract.ModelPetriNet
+	state       []int64
+}
+
+type snapshotFile struct {
+	ChainID int64            `json:"chain_id"`
+	Address string           `json:"address"`
+	Block   *Block           `json:"block"`
+	State   map[string]int64 `json:"state"`
+	Roles   map[string]uint8 `json:"roles"`
+}
+
+func LoadFile(path string) (*FileSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	src := &FileSource{Path: path}
+	src.declaration, err = model.DecodeJson(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	src.model, err = model.Compile(src.declaration)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var snapshot snapshotFile
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if common.IsHexAddress(snapshot.Address) {
+		src.Deployment = contract.Deployment{ChainID: snapshot.ChainID, Address: common.HexToAddress(snapshot.Address)}
+	}
+	src.block = snapshot.Block
+	if src.block == nil {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		src.block = &Block{Timestamp: uint64(info.ModTime().Unix())}
+	}
+	src.state = InitialState(src.model)
+	for label, value := range snapshot.State {
+		offset, ok := placeOffset(src.model, label)
+		if !ok {
+			return nil, fmt.Errorf("%s: state for unknown place %s", path, label)
+		}
+		src.state[offset] = value
+	}
+	for label, role := range snapshot.Roles {
+		for len(src.RoleLabels) <= int(role) {
+			src.RoleLabels = append(src.RoleLabels, "")
+		}
+		src.RoleLabels[role] = label
+	}
+	return src, nil
+}
+
+func placeOffset(net contract.ModelPetriNet, label string) (int, bool) {
+	for _, p := range net.Places {
+		if p.Label == label {
+			return int(p.Offset), true
+		}
+	}
+	return 0, false
+}
+
+func (s *FileSource) Block(number *big.Int) (*Block, error) {
+	if number != nil && number.Uint64() != s.block.Number {
+		return nil, NotFound("%s only holds block %d", s.Path, s.block.Number)
+	}
+	return s.block, nil
+}
+
+func (s *FileSource) Declaration(*bind.CallOpts) (contract.DeclarationPetriNet, error) {
+	return s.declaration, nil
+}
+
+func (s *FileSource) Model(*bind.CallOpts) (contract.ModelPetriNet, error) {
+	return s.model, nil
+}
+
+func (s *FileSource) State(contract.ModelPetriNet, *bind.CallOpts) ([]int64, error) {
+	return append([]int64(nil), s.state...), nil
+}
+
+// Roles grants every role the model's transitions use, a file has no access control.
+func (s *FileSource) Roles(net contract.ModelPetriNet, _ *bind.CallOpts) ([]uint8, error) {
+	var roles []uint8
+	seen := map[uint8]bool{}
+	for _, t := range net.Transitions {
+		if !seen[t.Role] {
+			seen[t.Role] = true
+			roles = append(roles, t.Role)
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i] < roles[j] })
+	return roles, nil
+}
@@ -3,10 +3,12 @@ package service
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 type TransactionLog struct {
 	TransactionHash string `json:"transaction_hash"`
+	Address         string `json:"address"`
 	BlockNumber     int    `json:"block_number"`
 	LogIndex        int    `json:"log_index"`
 	FromAddress     string `json:"from_address"`
@@ -18,26 +20,35 @@ type TransactionLog struct {
 	Scalar          string `json:"scalar"`
 }
 
+// LogsHandler serves the raw indexed logs. Their role and action names come from the TicTacToe
+// enums in transaction_logs_view and are empty for other models, EventsHandler labels signals by the model.
 func LogsHandler(w http.ResponseWriter, r *http.Request) {
+	if Psql == nil {
+		WriteError(w, r, errNoDatabase)
+		return
+	}
 	rows, err := Psql.Query(`
   SELECT
    transaction_hash,
+   address,
    block_number,
    log_index,
    from_address,
    data,
    removed,
    topic_hash,
-   role,
-   action,
+   coalesce(role::text, ''),
+   coalesce(action::text, ''),
    scalar
   FROM
    transaction_logs_view
+  WHERE
+   chain_id = $1 AND address = $2
   ORDER BY
    block_number, log_index DESC
- `)
+ `, RequestDeployment(r).ChainID, strings.ToLower(RequestDeployment(r).Address.Hex()))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, Database(err))
 		return
 	}
 	defer rows.Close()
@@ -47,6 +58,7 @@ func LogsHandler(w http.ResponseWriter, r *http.Request) {
 		var log TransactionLog
 		err := rows.Scan(
 			&log.TransactionHash,
+			&log.Address,
 			&log.BlockNumber,
 			&log.LogIndex,
 			&log.FromAddress,
@@ -57,14 +69,14 @@ func LogsHandler(w http.ResponseWriter, r *http.Request) {
 			&log.Action,
 			&log.Scalar)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, Database(err))
 			return
 		}
 		logs = append(logs, log)
 	}
 
 	if err = rows.Err(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, Database(err))
 		return
 	}
 
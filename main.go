@@ -3,77 +3,166 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/newrelic/go-agent/v3/integrations/logcontext-v2/logWriter"
 	"github.com/newrelic/go-agent/v3/newrelic"
 	_ "github.com/pflow-dev/pflow-xyz/protocol/server"
+	"github.com/stackdump/on-chain-summer-2024/internal/config"
 	"github.com/stackdump/on-chain-summer-2024/internal/contract"
 	"github.com/stackdump/on-chain-summer-2024/internal/page"
 	"github.com/stackdump/on-chain-summer-2024/internal/service"
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
 )
 
-func init() {
-	contract.Address = common.HexToAddress("0x7f1ed3d3aac8903f869eeb32182265dc34106353")
-	contract.Endpoint = os.Getenv("ENDPOINT")
-	if contract.Endpoint == "" {
-		contract.Endpoint = "https://base-sepolia.blastapi.io/0d1514f4-bfc2-4a18-87a1-323809684d73"
-	}
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"serve":     {"start the HTTP server and sync metrics", serveCommand},
+	"sync":      {"index a block range once: sync [-from N] [-to N]", syncCommand},
+	"snapshot":  {"print the contract snapshot: snapshot [-block N] [-format json] [-role R]", snapshotCommand},
+	"svg":       {"render the model: svg [-out file] [-color role] [-state live] [-layout L] [-format svg|png] [-width N]", svgCommand},
+	"replay":    {"rebuild state from the event log: replay [-address X] [-block N]", replayCommand},
+	"animate":   {"replay the event log as an animation: animate -out file.svg|file.gif [-player X] [-delay D]", animateCommand},
+	"simulate":  {"fire actions off chain: simulate -actions file [-live]", simulateCommand},
+	"codegen":   {"generate typed actions and a client for the model: codegen [-lang go|ts] [-out file]", codegenCommand},
+	"modeldiff": {"compare the model with a file or deployment before upgrading: modeldiff -against file|address [-block N]", modeldiffCommand},
+	"convert":   {"re-encode a model or recipe file: convert -in file [-format json|pnml|dot|mermaid|sol] [-check]", convertCommand},
 }
 
 func main() {
+	// without a subcommand the server starts, as it always has
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(args); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	username := os.Getenv("DB_USERNAME")
-	password := os.Getenv("DB_PASSWORD")
-	hostname := os.Getenv("DB_HOSTNAME")
-	appName := os.Getenv("APP_NAME")
-	configLicense, useNewRelic := os.LookupEnv("NEW_RELIC_LICENSE_KEY")
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun '%s <command> -h' for the flags of a command\n", os.Args[0])
+}
 
-	if useNewRelic {
+// load parses the command's flags together with the shared config flags.
+func load(fs *flag.FlagSet, args []string) (*config.Config, error) {
+	flags := config.Bind(fs)
+	_ = fs.Parse(args)
+	cfg, err := flags.Load()
+	if err != nil {
+		return nil, err
+	}
+	service.AdminToken = cfg.AdminToken
+	d := cfg.DefaultContract()
+	contract.ChainID = d.ChainID
+	contract.Address = common.HexToAddress(d.Address)
+	if cfg.Model != "" {
+		err = useModelFile(cfg.Model)
+	}
+	return cfg, err
+}
+
+// useModelFile serves the default contract from a local file, a saved snapshot keeps its chain and address.
+func useModelFile(path string) error {
+	src, err := service.LoadFile(path)
+	if err != nil {
+		return err
+	}
+	if src.Deployment != (contract.Deployment{}) {
+		contract.ChainID = src.Deployment.ChainID
+		contract.Address = src.Deployment.Address
+	}
+	if len(src.RoleLabels) > 0 {
+		service.SetRoleLabels(contract.Default(), src.RoleLabels)
+	}
+	service.UseSource(contract.Default(), src)
+	return nil
+}
+
+func setupTelemetry(cfg *config.Config) {
+	telemetry := cfg.Telemetry
+	if telemetry.NewRelic.License != "" {
 		service.Apm, _ = newrelic.NewApplication(
-			newrelic.ConfigAppName(appName),
-			newrelic.ConfigLicense(configLicense),
-			newrelic.ConfigAppLogForwardingEnabled(true),
+			newrelic.ConfigAppName(telemetry.AppName),
+			newrelic.ConfigLicense(telemetry.NewRelic.License),
+			newrelic.ConfigAppLogForwardingEnabled(telemetry.NewRelic.LogForwarding),
 		)
 		writer := logWriter.New(os.Stdout, service.Apm)
 		service.Logger = log.New(writer, "", log.Default().Flags())
-		service.Logger.Printf("NewRelic license set, APM enabled %s\n", appName)
+		service.Logger.Printf("NewRelic license set, APM enabled %s\n", telemetry.AppName)
 	} else {
 		service.Apm = nil
 		service.Logger = log.Default()
 		service.Logger.Print("NewRelic license not set, skipping APM, disable browser tracking\n")
 	}
+}
 
-	if username == "" {
-		log.Fatal("DB_USERNAME environment variable is not set")
-	}
-
-	if password == "" {
-		log.Fatal("DB_PASSWORD environment variable is not set")
+// setupDatabase opens Postgres, applies the configured registry and loads every chain from it.
+func setupDatabase(cfg *config.Config) error {
+	if err := cfg.Database.Validate(); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
 	}
-
-	// Database connection string
-	connStr := fmt.Sprintf("user=%s dbname=postgres sslmode=require password=%s host=%s", username, password, hostname)
-
-	// Open the connection
 	var err error
-	service.Psql, err = sql.Open("postgres", connStr)
+	service.Psql, err = sql.Open("postgres", cfg.Database.ConnString())
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	run()
+	err = service.ApplyConfig(cfg)
+	if err != nil {
+		return err
+	}
+	return service.LoadChains()
 }
 
-func run() {
-	log.Printf("Server start on port 8080")
+func serveCommand(args []string) error {
+	cfg, err := load(flag.NewFlagSet("serve", flag.ExitOnError), args)
+	if err != nil {
+		return err
+	}
+	setupTelemetry(cfg)
+	if cfg.Model != "" && cfg.Database.Validate() != nil {
+		log.Printf("serving %s without a database", cfg.Model)
+		service.UseConfigChains(cfg)
+	} else if err := setupDatabase(cfg); err != nil {
+		return err
+	}
+	// every chain must answer eth_chainId with its configured ID
+	if err := contract.Verify(); err != nil {
+		return err
+	}
+
+	log.Printf("Server start on %s", cfg.Listen)
 	ctx, cancel := context.WithCancel(context.Background())
 	service.Loop(ctx)
 
 	defer func(DB *sql.DB) {
 		cancel()
+		if DB == nil {
+			return
+		}
 		err := DB.Close()
 		if err != nil {
 			panic(err)
@@ -81,11 +170,17 @@ func run() {
 	}(service.Psql)
 
 	http.HandleFunc("/", page.IndexHandler)
-	http.HandleFunc("/v0/snapshot", service.SnapshotHandler)
-	http.HandleFunc("/v0/state", service.StateHandler)
-	http.HandleFunc("/v0/svg", service.SvgHandler)
-	http.HandleFunc("/v0/declaration", service.DeclarationHandler)
-	http.HandleFunc("/v0/logs", service.LogsHandler)
-	http.HandleFunc("/v0/highest_index", service.HighestIndexHandler)
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	http.Handle("/static/", page.StaticHandler)
+	http.HandleFunc("/debug", page.DebugHandler)
+	for name, handler := range service.Routes {
+		http.HandleFunc("/v0/"+name, handler)
+	}
+	http.HandleFunc("/v0/contracts", service.ContractsHandler)
+	http.HandleFunc("/v0/contracts/", service.ContractsHandler)
+	http.HandleFunc("/v0/chains", service.ChainsHandler)
+	http.HandleFunc("/v0/chains/", service.ChainsHandler)
+	http.HandleFunc("/v0/admin/contracts", service.AdminContractsHandler)
+	http.HandleFunc("/v0/admin/chains", service.AdminChainsHandler)
+	http.HandleFunc("/v0/admin/config", service.AdminConfigHandler(cfg.Redacted()))
+	return http.ListenAndServe(cfg.Listen, service.WithRequestId(http.DefaultServeMux))
 }
@@ -0,0 +1,17 @@
+#!/bin/bash
+# Golden-file check: every model in testdata must re-encode byte for byte in its own format,
+# see the round-trip tests in internal/model, and every recipe must compile.
+
+cd "$(dirname "$0")/.." || exit 1
+
+status=0
+go test ./internal/model/ -run 'RoundTrip' || status=1
+for f in internal/model/testdata/*.recipe; do
+    if go run . convert -in "$f" > /dev/null; then
+        echo "ok   $f"
+    else
+        echo "FAIL $f"
+        status=1
+    fi
+done
+exit $status
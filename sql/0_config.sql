@@ -1,12 +1,12 @@
-CREATE OR REPLACE FUNCTION config(p_name TEXT)
+-- Endpoint used by the indexer for a chain, the first configured endpoint wins.
+CREATE OR REPLACE FUNCTION chain_endpoint(p_chain_id BIGINT)
 RETURNS TEXT AS $$
 DECLARE
-    config_data JSONB := $config$
-        {
-            "endpoint": "http://127.0.0.1:8545",
-            "address": "0x7f1ed3d3aac8903f869eeb32182265dc34106353"
-        }
-        $config$::jsonb;
+    api_endpoint TEXT;
 BEGIN
-    RETURN config_data->>p_name;
+    SELECT endpoints[1] INTO api_endpoint FROM chains WHERE chain_id = p_chain_id;
+    IF api_endpoint IS NULL THEN
+        RAISE EXCEPTION 'no endpoint configured for chain %', p_chain_id;
+    END IF;
+    RETURN api_endpoint;
 END; $$ LANGUAGE plpgsql;
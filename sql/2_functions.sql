@@ -1,12 +1,13 @@
 CREATE EXTENSION http;
 
-CREATE OR REPLACE FUNCTION get_eth_transactions(address TEXT, block_number INT) RETURNS TABLE(transaction_hash TEXT, transaction_details JSONB, logs JSONB) AS $$
+CREATE OR REPLACE FUNCTION get_eth_transactions(p_chain_id BIGINT, addresses TEXT[], block_number INT) RETURNS TABLE(address TEXT, transaction_hash TEXT, transaction_details JSONB, logs JSONB) AS $$
 DECLARE
-    api_endpoint TEXT := (SELECT config('endpoint'));
+    api_endpoint TEXT := chain_endpoint(p_chain_id);
     hex_block_number TEXT := '0x' || to_hex(block_number);
     block JSONB;
     transaction JSONB;
     transaction_hash TEXT;
+    matched_address TEXT;
     request_id INT;
 BEGIN
     -- Get the next value from the sequence for the request ID
@@ -25,10 +26,14 @@ BEGIN
         'application/json'
     );
 
-    -- Extract transactions involving the specific address
+    -- Extract transactions involving any of the tracked addresses
     FOR transaction IN SELECT * FROM jsonb_array_elements(block->'result'->'transactions')
     LOOP
-        IF transaction->>'from' = address OR transaction->>'to' = address THEN
+        matched_address := CASE
+            WHEN lower(transaction->>'to') = ANY(addresses) THEN lower(transaction->>'to')
+            WHEN lower(transaction->>'from') = ANY(addresses) THEN lower(transaction->>'from')
+        END;
+        IF matched_address IS NOT NULL THEN
             transaction_hash := transaction->>'hash';
 
             -- Get the next value from the sequence for the request ID
@@ -64,15 +69,15 @@ BEGIN
             );
 
             -- Return the transaction details and logs
-            RETURN QUERY SELECT transaction_hash, transaction, logs->'result'->'logs';
+            RETURN QUERY SELECT matched_address, transaction_hash, transaction, logs->'result'->'logs';
         END IF;
     END LOOP;
 END;
 $$ LANGUAGE plpgsql;
 
-CREATE OR REPLACE FUNCTION get_latest_block_number() RETURNS INT AS $$
+CREATE OR REPLACE FUNCTION get_latest_block_number(p_chain_id BIGINT) RETURNS INT AS $$
 DECLARE
-    api_endpoint TEXT := (SELECT config('endpoint'));
+    api_endpoint TEXT := chain_endpoint(p_chain_id);
     response JSONB;
     latest_block_number INT;
     request_id INT;
@@ -92,41 +97,81 @@ BEGIN
          );
 
     -- Convert the block number from hexadecimal to integer
-    latest_block_number := ('x' || substring(response->>'result' from 3))::bit(24)::int;
+    latest_block_number := ('x' || lpad(substring(response->>'result' from 3), 16, '0'))::bit(64)::bigint;
 
     RETURN latest_block_number;
 END;
 $$ LANGUAGE plpgsql;
 
-CREATE OR REPLACE FUNCTION insert_next_block_number() RETURNS VOID AS $$
+CREATE OR REPLACE FUNCTION insert_next_block_number(p_chain_id BIGINT) RETURNS VOID AS $$
 DECLARE
+    -- Each inserted block costs an RPC call in the insert trigger, so a run stops after this many
+    max_blocks_per_poll CONSTANT INT := 100;
     max_block_number INT;
     latest_block_number INT;
+    confirmed_block_number INT;
 BEGIN
-    SELECT MAX(block_number) INTO max_block_number FROM block_numbers;
+    UPDATE chains SET last_polled_at = now() WHERE chain_id = p_chain_id;
 
+    -- A chain without contracts has nothing to index
+    IF NOT EXISTS (SELECT 1 FROM contracts WHERE chain_id = p_chain_id) THEN
+        RETURN;
+    END IF;
+
+    SELECT MAX(block_number) INTO max_block_number FROM block_numbers WHERE chain_id = p_chain_id;
+
+    -- Start from the earliest deployment on this chain
     IF max_block_number IS NULL THEN
-        max_block_number := 0;
+        SELECT GREATEST(MIN(deployment_block) - 1, 0) INTO max_block_number FROM contracts WHERE chain_id = p_chain_id;
     END IF;
 
-    -- Get the latest block number using the get_latest_block_number function
-    latest_block_number := get_latest_block_number();
+    -- Only index blocks that have reached the chain's confirmation depth
+    latest_block_number := get_latest_block_number(p_chain_id);
+    SELECT LEAST(latest_block_number - confirmations, max_block_number + max_blocks_per_poll)
+    INTO confirmed_block_number FROM chains WHERE chain_id = p_chain_id;
 
-    -- REVIEW: may want to do some number of max at a time
-    WHILE max_block_number < latest_block_number LOOP
+    WHILE max_block_number < confirmed_block_number LOOP
             max_block_number := max_block_number + 1;
-            INSERT INTO block_numbers (block_number) VALUES (max_block_number);
+            INSERT INTO block_numbers (chain_id, block_number) VALUES (p_chain_id, max_block_number);
+        END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+
+-- Index the blocks a contract missed because it was registered after the indexer passed them,
+-- a run indexes up to max_blocks_per_poll blocks per contract until it reaches the indexed head
+CREATE OR REPLACE FUNCTION backfill_contracts(p_chain_id BIGINT) RETURNS VOID AS $$
+DECLARE
+    max_blocks_per_poll CONSTANT INT := 100;
+    highest_index INT;
+    c RECORD;
+    last_block INT;
+BEGIN
+    SELECT MAX(block_number) INTO highest_index FROM block_numbers WHERE chain_id = p_chain_id;
+
+    FOR c IN
+        SELECT address, backfill_block FROM contracts
+        WHERE chain_id = p_chain_id AND backfill_block IS NOT NULL
+    LOOP
+        last_block := LEAST(c.backfill_block + max_blocks_per_poll - 1, highest_index);
+        FOR block IN c.backfill_block..last_block LOOP
+            PERFORM index_block(p_chain_id, ARRAY[lower(c.address)], block);
         END LOOP;
+
+        UPDATE contracts
+        SET backfill_block = CASE WHEN last_block >= highest_index THEN NULL ELSE last_block + 1 END
+        WHERE chain_id = p_chain_id AND address = c.address;
+    END LOOP;
 END;
 $$ LANGUAGE plpgsql;
 
 
-CREATE OR REPLACE FUNCTION get_block_stats() RETURNS TABLE(highest_index INT, latest INT, behind INT) AS $$
+CREATE OR REPLACE FUNCTION get_block_stats(p_chain_id BIGINT) RETURNS TABLE(highest_index INT, latest INT, behind INT) AS $$
 DECLARE
     latest_block_number INT;
 BEGIN
     -- Get the latest block number once
-    latest_block_number := get_latest_block_number();
+    latest_block_number := get_latest_block_number(p_chain_id);
 
     RETURN QUERY
     SELECT
@@ -134,14 +179,16 @@ BEGIN
         latest_block_number AS latest,
         latest_block_number - max(block_number) AS behind
     FROM
-        block_numbers;
+        block_numbers
+    WHERE
+        chain_id = p_chain_id;
 END;
 $$ LANGUAGE plpgsql;
 
 
-CREATE OR REPLACE FUNCTION get_block_by_number(block_number INT) RETURNS JSONB AS $$
+CREATE OR REPLACE FUNCTION get_block_by_number(p_chain_id BIGINT, block_number INT) RETURNS JSONB AS $$
 DECLARE
-    api_endpoint TEXT := (SELECT config('endpoint'));
+    api_endpoint TEXT := chain_endpoint(p_chain_id);
     hex_block_number TEXT := '0x' || to_hex(block_number);
     response JSONB;
     request_id INT;
@@ -1,12 +1,52 @@
+-- Table for storing the chains followed by the indexer
+CREATE TABLE chains (
+    chain_id BIGINT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    endpoints TEXT[] NOT NULL,
+    confirmations INT NOT NULL DEFAULT 0,
+    poll_interval_seconds INT NOT NULL DEFAULT 60,
+    last_polled_at TIMESTAMPTZ
+);
+
+INSERT INTO chains (chain_id, name, endpoints, confirmations, poll_interval_seconds) VALUES
+    (31337, 'hardhat', ARRAY['http://127.0.0.1:8545'], 0, 5),
+    (84532, 'base-sepolia', ARRAY['https://sepolia.base.org'], 3, 60),
+    (8453, 'base', ARRAY['https://mainnet.base.org'], 10, 60)
+ON CONFLICT (chain_id) DO NOTHING;
+
 -- Table for storing block numbers
 CREATE TABLE block_numbers (
-    block_number INT PRIMARY KEY
+    chain_id BIGINT REFERENCES chains (chain_id) ON DELETE CASCADE,
+    block_number INT,
+    PRIMARY KEY (chain_id, block_number)
 );
 
+-- Table for storing the model contracts followed by the indexer
+CREATE TABLE contracts (
+    chain_id BIGINT REFERENCES chains (chain_id) ON DELETE CASCADE,
+    address TEXT,
+    label TEXT NOT NULL DEFAULT '',
+    deployment_block INT NOT NULL DEFAULT 0,
+    -- next block to index for a contract registered after the indexer passed its deployment block
+    backfill_block INT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (chain_id, address)
+);
+
+INSERT INTO contracts (chain_id, address, label)
+VALUES (84532, '0x7f1ed3d3aac8903f869eeb32182265dc34106353', 'jetsam')
+ON CONFLICT (chain_id, address) DO NOTHING;
+
 -- Table for storing transaction data
 CREATE TABLE transactions (
-    transaction_hash TEXT PRIMARY KEY,
+    chain_id BIGINT,
+    transaction_hash TEXT,
+    address TEXT,
     transaction_details JSONB,
     logs JSONB,
-    block_number INT
+    block_number INT,
+    PRIMARY KEY (chain_id, transaction_hash),
+    FOREIGN KEY (chain_id, address) REFERENCES contracts (chain_id, address) ON DELETE CASCADE
 );
+
+CREATE INDEX transactions_address_block_idx ON transactions (chain_id, address, block_number);
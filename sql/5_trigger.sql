@@ -1,15 +1,29 @@
-CREATE OR REPLACE FUNCTION process_block_number() RETURNS TRIGGER AS $$
+-- Store the transactions of a block that involve any of the addresses
+CREATE OR REPLACE FUNCTION index_block(p_chain_id BIGINT, addresses TEXT[], p_block_number INT) RETURNS VOID AS $$
 DECLARE
-    address TEXT := (select config('address'));
     transaction RECORD;
 BEGIN
-    -- Call the get_eth_transactions function
-    FOR transaction IN SELECT * FROM get_eth_transactions(address, NEW.block_number)
+    FOR transaction IN SELECT * FROM get_eth_transactions(p_chain_id, addresses, p_block_number)
     LOOP
-        INSERT INTO transactions (transaction_hash, transaction_details, logs, block_number)
-        VALUES (transaction.transaction_hash, transaction.transaction_details, transaction.logs, NEW.block_number)
-        ON CONFLICT (transaction_hash) DO NOTHING;
+        INSERT INTO transactions (chain_id, transaction_hash, address, transaction_details, logs, block_number)
+        VALUES (p_chain_id, transaction.transaction_hash, transaction.address, transaction.transaction_details, transaction.logs, p_block_number)
+        ON CONFLICT (chain_id, transaction_hash) DO NOTHING;
     END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION process_block_number() RETURNS TRIGGER AS $$
+DECLARE
+    addresses TEXT[];
+BEGIN
+    -- Follow every registered contract that was deployed at or before this block
+    SELECT array_agg(lower(address)) INTO addresses
+    FROM contracts
+    WHERE chain_id = NEW.chain_id AND deployment_block <= NEW.block_number;
+
+    IF addresses IS NOT NULL THEN
+        PERFORM index_block(NEW.chain_id, addresses, NEW.block_number);
+    END IF;
 
     RETURN NEW;
 END;
@@ -21,3 +35,30 @@ AFTER INSERT ON block_numbers
 FOR EACH ROW
 EXECUTE FUNCTION process_block_number();
 
+
+-- A contract registered, or moved to an earlier deployment block, after the indexer passed that
+-- block is queued for backfill, see backfill_contracts
+CREATE OR REPLACE FUNCTION queue_contract_backfill() RETURNS TRIGGER AS $$
+DECLARE
+    highest_index INT;
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.deployment_block >= OLD.deployment_block THEN
+        NEW.backfill_block := OLD.backfill_block;
+        RETURN NEW;
+    END IF;
+
+    SELECT MAX(block_number) INTO highest_index FROM block_numbers WHERE chain_id = NEW.chain_id;
+    IF highest_index >= NEW.deployment_block THEN
+        NEW.backfill_block := NEW.deployment_block;
+    ELSE
+        NEW.backfill_block := NULL;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+
+CREATE TRIGGER contract_backfill_trigger
+BEFORE INSERT OR UPDATE OF deployment_block ON contracts
+FOR EACH ROW
+EXECUTE FUNCTION queue_contract_backfill();
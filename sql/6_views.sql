@@ -2,16 +2,20 @@ DROP MATERIALIZED VIEW transaction_logs_view ;
 CREATE MATERIALIZED VIEW transaction_logs_view AS
 WITH expanded_logs AS (
     SELECT
+        chain_id,
         transaction_hash,
+        address,
         block_number,
         jsonb_array_elements(logs) AS log_entry,
-        ROW_NUMBER() OVER (PARTITION BY transaction_hash ORDER BY transaction_hash) AS log_index,
+        ROW_NUMBER() OVER (PARTITION BY chain_id, transaction_hash ORDER BY transaction_hash) AS log_index,
         transaction_details->'result'->>'from' AS from_address
     FROM transactions
     WHERE logs IS NOT NULL
 )
 SELECT
+    chain_id,
     transaction_hash,
+    address,
     block_number,
     log_index,
     from_address,
@@ -55,4 +59,4 @@ SELECT
         END AS scalar_enum
     ) AS scalar
 FROM expanded_logs
-ORDER BY block_number, log_index;
+ORDER BY chain_id, block_number, log_index;
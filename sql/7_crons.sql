@@ -1,6 +1,20 @@
+-- Poll every chain whose poll interval has elapsed, a chain that fails is retried on the next run
 CREATE OR REPLACE FUNCTION refresh_and_insert() RETURNS VOID AS $$
+DECLARE
+    chain RECORD;
 BEGIN
-    PERFORM insert_next_block_number();
+    FOR chain IN
+        SELECT chain_id FROM chains
+        WHERE last_polled_at IS NULL
+           OR last_polled_at + make_interval(secs => poll_interval_seconds) <= now()
+    LOOP
+        BEGIN
+            PERFORM insert_next_block_number(chain.chain_id);
+            PERFORM backfill_contracts(chain.chain_id);
+        EXCEPTION WHEN OTHERS THEN
+            RAISE WARNING 'polling chain % failed: %', chain.chain_id, SQLERRM;
+        END;
+    END LOOP;
     REFRESH MATERIALIZED VIEW transaction_logs_view;
 END;
 $$ LANGUAGE plpgsql;
@@ -8,5 +22,5 @@ $$ LANGUAGE plpgsql;
 -- REVIEW: Other setup needed?
 CREATE EXTENSION pg_cron;
 
--- schedule runs every minute
--- SELECT cron.schedule('*/1 * * * * *', 'SELECT refresh_and_insert()');
+-- schedule runs every 5 seconds, each chain is only polled once its own interval has elapsed
+-- SELECT cron.schedule('*/5 * * * * *', 'SELECT refresh_and_insert()');
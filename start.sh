@@ -3,5 +3,6 @@ export NEW_RELIC_LICENSE_KEY="XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX"
 export DB_HOSTNAME="127.0.0.1"
 export DB_PASSWORD="XXXXXXXXXXXXXXXXXXXXXXXXX"
 export DB_USERNAME="XXXXXXXXXXXXXXXXXXXXXXXXXXXXX"
+export ADMIN_TOKEN="XXXXXXXXXXXXXXXXXXXXXXXXX"
 
-go run main.go
+go run . serve -config config/staging.yaml